@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	"github.com/creachadair/stockopt"
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/ledger"
+	"github.com/creachadair/stockopt/statement"
+)
+
+// commitPlan records the lots sold by p in the ledger l, with amounts in the
+// reporting currency, and saves the ledger to path.
+func commitPlan(l *ledger.Ledger, path string, p *stockopt.Plan) error {
+	var lots []ledger.Lot
+	for _, elt := range p.Result.Entries {
+		e := elt.ID.(*statement.Entry)
+		lots = append(lots, ledger.Lot{
+			Symbol:   e.Symbol,
+			Plan:     e.Plan,
+			Acquired: e.Acquired,
+			Basis:    e.IssuePrice,
+			Shares:   elt.N,
+			Price:    elt.Value,
+			Gain:     elt.Gain,
+		})
+	}
+	if len(lots) == 0 {
+		return nil
+	}
+	l.Add(p.SaleDate(), reportCode, lots)
+	return l.Save(path)
+}
+
+// printHistory writes the sales committed to l, in order of sale, with the
+// cumulative gains realized in each calendar year. The yearly totals are in the
+// currency of the first sale.
+func printHistory(w io.Writer, l *ledger.Ledger) {
+	if len(l.Sales) == 0 {
+		fmt.Fprintln(w, "No sales are committed")
+		return
+	}
+	code := l.Sales[0].Currency
+	for _, s := range l.Sales {
+		if s.Currency != code {
+			log.Printf("Warning: the ledger records sales in both %s and %s; yearly gains add them unconverted", code, s.Currency)
+			break
+		}
+	}
+	sales := append([]*ledger.Sale(nil), l.Sales...)
+	sort.SliceStable(sales, func(i, j int) bool { return sales[i].Date.Before(sales[j].Date) })
+	var year int
+	var ytd currency.Value
+	for _, s := range sales {
+		if s.Date.Year() != year {
+			year, ytd = s.Date.Year(), 0
+		}
+		shares, value, gains := s.Totals()
+		ytd += gains
+		fmt.Fprintf(w, "Sale %s: %d shares, proceeds %s, gains %s (%d year to date: %s)\n",
+			s.Date.Format(statement.DateFormat), shares, value.Format(s.Currency), gains.Format(s.Currency),
+			year, ytd.Format(code))
+		for _, lot := range s.Lots {
+			fmt.Fprintf(w, "  %d %s -- acquired %s : issue %s price %s gains %s\n",
+				lot.Shares, lot.Plan, lot.Acquired.Format(statement.DateFormat),
+				lot.Basis.Format(s.Currency), lot.Price.Format(s.Currency), lot.Gain.Format(s.Currency))
+		}
+	}
+	fmt.Fprintln(w, "\nRealized gains by year:")
+	gains := l.YearGains()
+	years := make([]int, 0, len(gains))
+	for y := range gains {
+		years = append(years, y)
+	}
+	sort.Ints(years)
+	for _, y := range years {
+		fmt.Fprintf(w, "  %d:\t%s\n", y, gains[y].Format(code))
+	}
+}
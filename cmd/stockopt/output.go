@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/creachadair/stockopt"
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/solver"
+	"github.com/creachadair/stockopt/statement"
+)
+
+// writeTax8949 writes the lots sold by soln to w as CSV, one row per lot in the
+// layout of Form 8949.
+func writeTax8949(w io.Writer, soln []solver.Entry, saleDate time.Time) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{
+		"Description", "Date Acquired", "Date Sold", "Proceeds", "Cost Basis", "Gain or Loss", "Term",
+	}); err != nil {
+		return err
+	}
+	for _, elt := range soln {
+		e := elt.ID.(*statement.Entry)
+		name := e.Symbol
+		if name == "" {
+			name = e.Plan
+		}
+		term := "Short"
+		if e.IsLongTerm(saleDate) {
+			term = "Long"
+		}
+		n := currency.Value(elt.N)
+		if err := cw.Write([]string{
+			fmt.Sprintf("%d sh %s", elt.N, name),
+			e.Acquired.Format(statement.DateFormat),
+			saleDate.Format(statement.DateFormat),
+			(n * elt.Value).Decimal(),
+			(n * e.IssuePrice).Decimal(),
+			(n * elt.Gain).Decimal(),
+			term,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// printWashSales writes a table of the replacement lots whose basis would be
+// adjusted by adj, and the total loss disallowed. Replacement lots are listed
+// by plan and acquisition date, since they need not be eligible for sale.
+func printWashSales(w io.Writer, adj []stockopt.WashAdjustment) {
+	fmt.Fprintln(w, "\nWash sales:")
+	if len(adj) == 0 {
+		fmt.Fprintln(w, "  No losses are disallowed")
+		return
+	}
+	var total currency.Value
+	for _, a := range adj {
+		n := currency.Value(a.Shares)
+		total += n * a.Disallowed
+		fmt.Fprintf(w, "  %d of %d %s acquired %s: basis %s + %s = %s per share\n",
+			a.Shares, a.Lot.Available, a.Lot.Plan, a.Lot.Acquired.Format(statement.DateFormat),
+			a.Lot.IssuePrice.Format(reportCode), a.Disallowed.Format(reportCode), (a.Lot.IssuePrice + a.Disallowed).Format(reportCode))
+	}
+	fmt.Fprintf(w, "Disallowed loss:\t%s\n", total.Format(reportCode))
+}
+
+// printDiagnostics writes whether the solver found a provably optimal plan,
+// and otherwise how far the plan may be from optimal.
+func printDiagnostics(w io.Writer, d *solver.Diagnostics) {
+	if d.Optimal {
+		fmt.Fprintf(w, "Solver:\t\toptimal (exact search, %s)\n", plural(d.Nodes, "node"))
+		return
+	}
+	fmt.Fprintf(w, "Solver:\t\twithin %s of optimal (upper bound %s)", d.Gap().Format(reportCode), d.Bound.Format(reportCode))
+	if d.Aborted {
+		fmt.Fprintf(w, "; exact search stopped after %s", plural(d.Nodes, "node"))
+	}
+	fmt.Fprintln(w)
+}
+
+// plural returns n and the noun, in the plural unless n == 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/stockopt"
+	"github.com/creachadair/stockopt/currency"
+)
+
+// A statement with a lot at a loss, and, unless it is removed, a lot acquired
+// 11 days before the sale date of TestWashSales.
+const washStatement = `Gain/Loss report
+Symbol: GOOG
+Currency,,usd
+Acquired Date,Plan Name,Acquired Price,Acquired Via,Shares Available for Sale,Current Market Value,Unrealized Total Gain/Loss
+01/15/2020,GSU Class C,$700.00,Release,10,$15000.00,$8000.00
+02/29/2020,GSU Class C,$1200.00,Release,5,$7500.00,$1500.00
+06/15/2024,GSU Class C,$1600.00,Release,8,$12000.00,-$800.00
+09/20/2025,GSU Class C,$1400.00,Release,4,$6000.00,$400.00
+`
+
+func TestWashSales(t *testing.T) {
+	saleDate := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	recent := "09/20/2025,GSU Class C,$1400.00,Release,4,$6000.00,$400.00\n"
+	tests := []struct {
+		name      string
+		statement string
+		c         stockopt.Constraints
+		sold      int    // shares sold
+		want      string // a line of the output
+	}{
+		// The loss lot is sold within the window of the acquisition of the
+		// four recent shares, whose basis carries $100 each of the loss.
+		{"Loss", washStatement, stockopt.Constraints{GainsCap: 5000 * currency.Dollars, AllowLoss: true},
+			18, "Disallowed loss:\t$400.00"},
+
+		// Harvesting excludes the loss lot rather than disallow its loss.
+		{"Harvest", washStatement, stockopt.Constraints{Loss: 500 * currency.Dollars},
+			0, "  No losses are disallowed"},
+
+		// Without the recent acquisition there is no wash sale.
+		{"HarvestNoRecent", strings.Replace(washStatement, recent, "", 1), stockopt.Constraints{Loss: 500 * currency.Dollars},
+			5, "  No losses are disallowed"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := new(stockopt.Portfolio)
+			if err := p.Add(tc.name, []byte(tc.statement), nil); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			c := tc.c
+			c.SaleDate = saleDate
+			plan, err := stockopt.Build(p, &c)
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			if n := stockopt.Summarize(plan.Result.Entries).Shares; n != tc.sold {
+				t.Errorf("Build: sold %d shares, want %d", n, tc.sold)
+			}
+			var buf bytes.Buffer
+			printWashSales(&buf, stockopt.WashSales(plan.Result.Entries, plan.Replacements, saleDate))
+			if !strings.Contains(buf.String(), "\n"+tc.want+"\n") {
+				t.Errorf("printWashSales: got %q, want line %q", buf.String(), tc.want)
+			}
+		})
+	}
+}
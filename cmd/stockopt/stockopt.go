@@ -0,0 +1,1321 @@
+// Program stockopt optimizes a stock sale subject to limitations of capital
+// gains.  The input to the program is an .xls or .xlsx spreadsheet as
+// generated from the Gain/Loss view of the MSSB stock plan site, or the same
+// report exported as CSV.
+//
+// The output is a table listing how many of each lot of stock should be sold,
+// the total sale price based on the estimated sale values from MSSB, and the
+// total capital gain from the sale.
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creachadair/stockopt"
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/ledger"
+	"github.com/creachadair/stockopt/quote"
+	"github.com/creachadair/stockopt/report"
+	"github.com/creachadair/stockopt/solver"
+	"github.com/creachadair/stockopt/statement"
+)
+
+var (
+	ageMonths    = flag.Int("age", 12, "Minimum age in months (default: held past -long-term-period)")
+	planFilter   = flag.String("plan", "GSU Class C", "Consider only shares issued under this plan (MSSB statements)")
+	inputFormat  = flag.String("format", "", "Input statement format (mssb, schwab, etrade, fidelity; default detected)")
+	capGainLimit = flag.String("gain", "$0", "Capital gain limit")
+	longGainCap  = flag.String("gain-long", "$0", "Long-term capital gain limit")
+	shortGainCap = flag.String("gain-short", "$0", "Short-term capital gain limit (implies all lots are eligible)")
+	marketPrice  = flag.String("market", "$0", "Market price override")
+	printSummary = flag.Bool("summary", false, "Print summary of available shares and exit")
+	allowLoss    = flag.Bool("loss", false, "Allow sale of capital losses")
+	taxRate      = flag.Float64("tax", 20, "Capital gains tax rate (percent, e.g., 18.8)")
+	shortTaxRate = flag.Float64("stax", 0, "Short-term capital gains tax rate (percent; implies all lots are eligible)")
+	haveCash     = flag.String("have-cash", "$0", "Cash already on hand, with -need-cash")
+	needCash     = flag.String("need-cash", "$0", "Total cash needed; raises the shortfall from -have-cash")
+	fedTaxRate   = flag.Float64("fed-tax", 0, "Federal capital gains tax rate (percent; with -state-tax, replaces -tax)")
+	stateTaxRate = flag.Float64("state-tax", 0, "State capital gains tax rate (percent; with -fed-tax, replaces -tax)")
+	raiseTarget  = flag.String("raise", "$0", "Target sale proceeds (implies -objective min-gain)")
+	harvestLoss  = flag.String("harvest", "$0", "Target capital loss to realize (implies -objective harvest)")
+	objective    = flag.String("objective", "", "Optimization objective (max-value, value-then-compact, min-gain, harvest)")
+	liveQuote    = flag.Bool("live", false, "Fetch the market price from a quote service (see -quote-url)")
+	tickerSymbol = flag.String("ticker", "", "Symbol of the security to quote (implies -live; default from the statement)")
+	quoteURL     = flag.String("quote-url", "", "URL template for -live quotes, with {symbol} (default $STOCKOPT_QUOTE_URL or Yahoo Finance)")
+	quoteField   = flag.String("quote-field", "", "Path of the price in a JSON quote, e.g., quote.0.price (default $STOCKOPT_QUOTE_FIELD)")
+	forceMarket  = flag.Bool("force-market", false, "Accept a -market price far from the statement price")
+	strictMode   = flag.Bool("strict", false, "Treat warnings about the input as fatal errors")
+	maxGainRatio = flag.Float64("max-gain-ratio", 0, "Maximum ratio of realized gain to proceeds with -raise (e.g., 0.2)")
+	saleDateFlag = flag.String("date", "", "Date of the sale as YYYY-MM-DD (default today)")
+	taxLimit     = flag.String("max-tax", "$0", "Maximum estimated gains tax, at the -tax rate")
+	compareFIFO  = flag.Bool("compare-fifo", false, "Compare the sale profile to a first-in, first-out sale")
+	outputMode   = flag.String("output", "text", "Output format (text, json, csv, tax8949, canonical)")
+	maxLotFrac   = flag.Float64("max-lot-fraction", 0, "Maximum fraction of each lot to sell (e.g., 0.25)")
+	valuesPath   = flag.String("values", "", "CSV file of lot,value pairs overriding the sale value per share")
+	maxRows      = flag.Int("max-rows", 0, "Maximum number of sold lots to list in text output (0 means all)")
+	dumpInput    = flag.Bool("dump-solver-input", false, "Print the entries given to the solver before solving")
+	planYears    = flag.Int("years", 0, "Plan sales over this many years, with -annual-gain")
+	annualGain   = flag.String("annual-gain", "$0", "Capital gain limit per year, with -years")
+	bestAfterTax = flag.Bool("best-after-tax", false, "Mark the sweep scenario with the largest after-tax proceeds")
+	statePath    = flag.String("state", "", "Ledger file of committed sales (JSON)")
+	commitSale   = flag.Bool("commit", false, "Record the sale profile in the -state ledger")
+	showHistory  = flag.Bool("history", false, "Print the sales committed to the -state ledger and exit")
+	washSale     = flag.Bool("wash-sale", false, "Report basis adjustments for losses disallowed as wash sales")
+	currencyCode = flag.String("currency", "", "Reporting currency code, e.g., EUR (default the currency of the statements)")
+	ratesPath    = flag.String("rates-file", "", "CSV file of code,rate exchange rates (see -rate)")
+	exactSearch  = flag.Bool("exact", false, "Search for a provably optimal profile however long the search takes")
+
+	inputPaths  stringList
+	gainRange   valueRange
+	marketRange valueRange
+	planHold    = make(planHolds)
+	symbolGains = make(gainCaps)
+	rates       = make(currency.Rates)
+	longTerm    = statement.DefaultLongTerm
+	maxStale    = statement.Period{Days: 7}
+
+	// reportCode is the code of the reporting currency, in which amounts are
+	// read and written. It is set once the statements are read.
+	reportCode = "USD"
+)
+
+// stringList implements flag.Value, accepting repeated string arguments.
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+// gainCaps maps security symbols to a cap on gains realized from them. It
+// implements flag.Value, accepting repeated "symbol=amount" arguments.
+type gainCaps map[string]currency.Amount
+
+func (g gainCaps) String() string {
+	var parts []string
+	for sym, a := range g {
+		parts = append(parts, sym+"="+a.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (g gainCaps) Set(s string) error {
+	sym, amount, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("invalid gain cap %q (want symbol=amount)", s)
+	}
+	a, err := currency.ParseAmount(amount)
+	if err != nil {
+		return err
+	}
+	g[sym] = a
+	return nil
+}
+
+// convert converts the caps of g to the reporting currency.
+func (g gainCaps) convert() error {
+	for sym, a := range g {
+		v, err := toReport(a)
+		if err != nil {
+			return fmt.Errorf("gain cap for %s: %w", sym, err)
+		}
+		g[sym] = currency.Amount{Value: v, Code: reportCode}
+	}
+	return nil
+}
+
+// planHolds maps plan names to a minimum holding period imposed by the plan.
+// It implements flag.Value, accepting repeated "plan=period" arguments.
+type planHolds map[string]statement.Period
+
+func (h planHolds) String() string {
+	var parts []string
+	for plan, p := range h {
+		parts = append(parts, plan+"="+p.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (h planHolds) Set(s string) error {
+	plan, period, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("invalid plan holding period %q (want plan=period)", s)
+	}
+	p, err := statement.ParsePeriod(period)
+	if err != nil {
+		return err
+	}
+	h[plan] = p
+	return nil
+}
+
+func init() {
+	flag.StringVar(raiseTarget, "proceeds", "$0", "Alias for -raise")
+	flag.StringVar(longGainCap, "lt-gain", "$0", "Alias for -gain-long")
+	flag.StringVar(shortGainCap, "st-gain", "$0", "Alias for -gain-short")
+	flag.Float64Var(taxRate, "lt-tax", 20, "Alias for -tax")
+	flag.Float64Var(shortTaxRate, "st-tax", 0, "Alias for -stax")
+	flag.Var(&inputPaths, "input", "Input .xls, .xlsx, or .csv file (repeatable, to merge statements)")
+	flag.Var(symbolGains, "symbol-gain", "Capital gain limit for one security, as symbol=amount (repeatable)")
+	flag.Var(&maxStale, "max-staleness", "Warn if the statement date is older than this period")
+	flag.Var(&longTerm, "long-term-period", "Holding period after which gains are long-term")
+	flag.Var(&gainRange, "gain-range", "Sweep the gains cap over lo:hi:step, e.g., $0:$50000:$10000")
+	flag.Var(&marketRange, "market-range", "Sweep the market price over lo:hi:step")
+	flag.Var(rates, "rate", "Exchange rate of a currency, as code=rate in the reporting currency (repeatable)")
+	flag.Var(planHold, "plan-hold", "Minimum holding period for a plan, as plan=period (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: %[1]s -input file.xls -summary  # summarize available shares
+       %[1]s -input file.xls -gain v   # generate a sale profile
+       %[1]s -input file.xls -raise v  # raise cash with minimal gain
+
+Read a MSSB gain/loss report from an .xls, .xlsx, or CSV file and generate a
+stock sale profile that maximizes total sale value for a given market price
+without exceeding the specified maximum capital gain. The format of the input
+is detected from its contents.
+
+Alternatively, use -raise to generate a profile that raises at least the given
+amount of cash while realizing the smallest possible capital gain (-proceeds is
+a synonym for -raise). The -age, -plan, and -loss filters apply in the same way
+as for a gains cap. Among plans with the same gain, the one selling from the
+fewest lots is preferred. For up to %[3]d eligible lots, or with -exact, the
+profile is found by an exhaustive search; for more lots it is found greedily,
+and its gain may exceed the smallest possible. The -raise and -gain options
+are mutually exclusive. If the available shares cannot raise the target, the
+profile sells all of them and a warning is printed.
+
+With -raise, use -max-gain-ratio to also require that the realized gain is at
+most the given fraction of the proceeds, e.g., -max-gain-ratio 0.2 for a gain
+of no more than 20%% of the cash raised.
+
+Use -date to plan a sale on a date other than today. Holding periods are
+measured up to the sale date. A past date describes a historical scenario:
+combine it with -market to use the price on that day, e.g., to evaluate what
+plan an earlier sale would have produced.
+
+Use -fed-tax and -state-tax instead of -tax to give federal and state rates
+separately; the tax is estimated at their sum, and each part is reported.
+
+Use -max-tax to limit the estimated tax on the sale at the -tax rate instead of
+(or in addition to) limiting the gains directly with -gain.
+
+Use -max-lot-fraction to sell at most the given fraction of each lot, rounded
+down, e.g., -max-lot-fraction 0.25 to trim every lot by no more than 25%%. The
+gains cap still applies, so either limit may bound the sale.
+
+Use -values to give specific lots a different sale value per share, e.g., for
+a negotiated block sale. The file is CSV with rows of lot number (as shown by
+-summary) and value per share; the gains of those lots are computed from the new
+value, and other lots keep the market value.
+
+Use -gain-range to compare the profiles for a range of gains caps in one run,
+e.g., -gain-range '$0:$50000:$10000' for caps of $0, $10000, and so on up to
+$50000, or -market-range to compare them for a range of market prices. Given
+both, every combination is compared. The statements are read once, and a
+table lists the shares sold, proceeds, gains, estimated tax, and after-tax
+proceeds of each scenario. Use -best-after-tax to mark the scenario with the
+largest after-tax proceeds.
+
+Use -compare-fifo to compare the profile to selling the oldest lots first under
+the same gains cap, as brokers do when specific lots are not identified.
+
+Use -output tax8949 to write the sale profile as CSV rows for Form 8949, one
+per lot, with the description, acquisition and sale dates, proceeds, cost
+basis, gain or loss, and whether the gain is short- or long-term.
+
+Use -output json to write the sale profile as a JSON object, with a record for
+each lot sold and a list of the constraints at their limit ("sold-out" when
+every share of a lot is sold, "lot-cap" when a lot is sold to its
+-max-lot-fraction ceiling, "gain-cap" when another share of a lot would exceed
+the gains cap, or "gain-cap:SYM" for a -symbol-gain cap) with the lots each
+applies to.
+
+Use -need-cash in place of -raise to give the total cash needed, and -have-cash
+for the cash already on hand; the profile raises the shortfall between them.
+
+Use -harvest to generate a profile that realizes at least the given capital
+loss, for tax-loss harvesting, e.g., -harvest '$3000'. Only lots with a loss
+are sold, and the profile sells as little total value as possible. A lot is
+excluded, with a warning, if its sale at a loss would be a wash sale because
+other shares of the same security were acquired within %[2]d days before or
+after the sale date. The -age and -plan filters apply as usual.
+
+Use -years and -annual-gain to plan a sale over several years, e.g., -years 3
+-annual-gain '$20000'. The years are one year apart, starting at the sale date.
+Each year sells the most value it can within the annual cap from the shares not
+sold in earlier years, including lots that become eligible (see -age) in that
+year. The schedule lists the lots sold in each year, with the proceeds, gains,
+and estimated tax of the year.
+
+Use -state to keep a ledger of executed sales in a JSON file, and -commit to
+record the sale profile in it once the sale is made. A statement may not
+reflect a sale for some days, so the shares committed to the ledger by sales
+after the date of a statement (or by all sales, if the statement is not dated)
+are excluded from its lots. Lots are matched by plan, acquisition date, and
+cost basis. Use -history to list the committed sales, with the gains realized
+in each year to date.
+
+Use -wash-sale to report the wash-sale consequences of a plan that realizes
+losses (see -loss). Losses on shares sold are disallowed to the extent that
+other lots of the same security in the statement were acquired within %[2]d days
+before or after the sale date and are not sold. The disallowed loss carries to
+the cost basis of those replacement lots, and stockopt prints a table of the
+replacement lots and their adjusted basis per share.
+
+Use -output json or -output csv to write the sale profile, or with -summary
+the available shares, in a machine-readable format. The JSON output includes
+the input parameters, one record per lot, and the totals of the sale with the
+estimated tax. The CSV output has one row per lot giving the lot number, the
+acquisition date, the shares sold, the value per share, the gain and cost
+basis of the shares sold, the date the lot becomes long-term, and the term
+(LT or ST) of the sale, followed by a row of totals. The JSON records of the
+lots give the same date and term. Amounts are written as
+strings in the same format as the text output, e.g., "$1234.56", and the
+JSON parameters give the reporting currency.
+
+Use -output canonical to write the sale profile in a stable text format meant
+for tracking plans in version control: one line per lot sold, ordered by lot
+number, with fixed-width columns and plain amounts, followed by a line of
+totals. The output does not depend on the run date or input file names.
+
+Use -objective value-then-compact to break ties between profiles of equal value
+in favour of selling fewer shares, and then fewer lots.
+
+A profile under a gains cap is found from a table of the best sales of each
+lot, and a branch-and-bound search then checks it, replacing it with a better
+profile if there is one. The search stops after a fixed number of steps, so a
+profile is not guaranteed to be optimal. The text and JSON output report
+whether the profile is provably optimal, and otherwise give an upper bound on
+the value of an optimal profile and the gap between the two (with -stax, the
+values are net of tax). Use -exact to run the search without limiting its
+length; it may be slow for large statements.
+
+By default:
+
+- A statement dated more than -max-staleness (default 7d) ago draws a warning,
+  since its prices are likely out of date. With -strict, this is an error.
+
+- The market price is derived from the value stated in the report; use -market
+  to use a different value, e.g., for a limit order. A -market price more than
+  10x away from the stated price is usually a mistake (e.g., a total value
+  instead of a per-share price), and draws a warning unless -force-market is
+  set.
+
+- Prices are not fetched from the network. Use -live to fetch the market
+  price of the security named in the statement from a quote service, or
+  -ticker to name the symbol to quote. The service is given by -quote-url or
+  $STOCKOPT_QUOTE_URL, a URL in which {symbol} is replaced by the symbol
+  (default: the Yahoo Finance chart API), and -quote-field or
+  $STOCKOPT_QUOTE_FIELD, the path of the price in its JSON response (e.g.,
+  "quote.0.price"; if empty, the response is the price as text). If the quote
+  cannot be fetched, a warning is logged and the statement price is used; with
+  -strict, this is an error.
+
+- Sales resulting in a capital loss are not considered; use -loss to allow the
+  optimizer to include sales resulting in a capital loss in the plan.
+
+- Only shares whose sale would be long-term are considered for sale; use -age
+  to set a different threshold in months. A sale is long-term if the shares
+  were held for more than -long-term-period, with a default of 1y (the U.S.
+  rule): shares acquired on 2020-01-15 are long-term on or after 2021-01-16.
+  Set -long-term-period for jurisdictions with a different rule, e.g., 2y; the
+  period must be positive.
+
+- Shares may be sold as soon as they pass the -age threshold. Some plans also
+  restrict sales until shares have been held for a minimum period; use
+  -plan-hold to enforce such a rule, e.g., -plan-hold "GSU Class C=2y". Unlike
+  -age, which reflects the tax treatment of a sale, a plan holding period is a
+  restriction on whether the sale is permitted at all, and lots excluded by it
+  are reported. Periods are written as counts of years, months, and days, e.g.,
+  "2y", "18m", "1y6m", "90d".
+
+Statements exported by Schwab (Equity Awards lot details), E*TRADE (Gains &
+Losses), and Fidelity (lot details) as CSV are also accepted. The format of
+each input is detected from its contents, or may be given with -format. For
+statements other than MSSB, no -plan filter applies unless -plan is set.
+
+Use -input more than once to merge statements, for example for awards of
+several securities. Use -symbol-gain to cap the gains realized from one
+security, e.g., -symbol-gain GOOG='$10000'; the -gain cap applies to the total
+across all securities.
+
+Amounts are read and reported in the currency of the statements, as stated in
+a Currency row or marked on their amounts (e.g., €1234.56 or 1234.56 CHF), and
+otherwise in USD. Use -currency to report statements in a different currency,
+or to merge statements in several currencies, which is otherwise an error. The
+amounts of other currencies are converted at the exchange rates given by -rate,
+e.g., -currency USD -rate EUR=1.08 -rate GBP=1.27, or by -rates-file, a CSV
+file of code,rate rows. A rate is the value of one unit of the currency in the
+reporting currency, unless the reporting currency has a rate of its own, in
+which case the rates are relative to a common base. An amount given without a
+symbol or code, e.g., -gain 5000, is in the reporting currency; one marked with
+another currency, e.g., -gain '$5000', is converted. Rates are not fetched from
+the network, and a -live quote is taken to be in the reporting currency. The
+-state ledger records sales in the reporting currency, and matches them only
+to lots reported in the same currency.
+
+Use -stax to give the tax rate on short-term gains; -tax then applies to
+long-term gains. With -stax, short-term lots are eligible for sale unless -age
+is also set, and the profile maximizes the total value after the estimated tax
+on each lot's gain rather than the total value. Each lot sold is labelled LT
+(long-term) or ST (short-term).
+
+Use -gain-long and -gain-short to cap long-term and short-term gains
+separately, based on the holding period of each lot at the sale date (see
+-long-term-period). With -gain-short, short-term lots are eligible for sale
+unless -age is also set. Either cap defaults to zero, and unless -gain is also
+set, the total gains are bounded only by the two caps.
+
+The -lt-gain, -st-gain, -lt-tax, and -st-tax options are synonyms for
+-gain-long, -gain-short, -tax, and -stax respectively.
+
+Use -summary to report on all available shares without generating a sale
+profile.
+
+Options:
+`, filepath.Base(os.Args[0]), stockopt.WashWindow, solver.ExactLimit)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+	var sales *ledger.Ledger
+	if *statePath != "" {
+		var err error
+		if sales, err = ledger.Load(*statePath); err != nil {
+			log.Fatalf("Reading ledger: %v", err)
+		}
+	} else if *commitSale || *showHistory {
+		log.Fatal("The -commit and -history options require a -state ledger")
+	}
+	if *showHistory {
+		printHistory(os.Stdout, sales)
+		return
+	}
+	if len(inputPaths) == 0 {
+		log.Fatal("You must provide an -input statement path")
+	} else if !(*taxRate >= 0 && *taxRate <= 100) {
+		log.Fatal("You must provide a -tax rate between 0..100 percent")
+	}
+	if splitTax() {
+		// The combined rate replaces -tax for all tax computations.
+		if isSet("tax") {
+			log.Fatal("Use either -tax or -fed-tax and -state-tax, not both")
+		} else if !(*fedTaxRate >= 0 && *stateTaxRate >= 0 && *fedTaxRate+*stateTaxRate <= 100) {
+			log.Fatal("The -fed-tax and -state-tax rates must total between 0..100 percent")
+		}
+		*taxRate = *fedTaxRate + *stateTaxRate
+	}
+	if isSet("stax") && !(*shortTaxRate >= 0 && *shortTaxRate <= 100) {
+		log.Fatal("You must provide a -stax rate between 0..100 percent")
+	}
+	if longTerm == (statement.Period{}) {
+		// A zero period would silently select the default.
+		log.Fatal("The -long-term-period must be positive, e.g., 1y")
+	}
+
+	// Read and parse the input spreadsheets. Amounts are reported in the
+	// -currency, if it is set, and otherwise in the currency of the statements.
+	var format statement.Format
+	if *inputFormat != "" {
+		if format = statement.LookupFormat(*inputFormat); format == nil {
+			log.Fatalf("Unknown -format %q", *inputFormat)
+		}
+	}
+	if *ratesPath != "" {
+		if err := readRates(*ratesPath); err != nil {
+			log.Fatalf("Reading exchange rates: %v", err)
+		}
+	}
+	opts := &stockopt.LoadOptions{Format: format, LongTerm: longTerm}
+	if *currencyCode != "" {
+		reportCode = strings.ToUpper(*currencyCode)
+		if len(reportCode) != 3 {
+			log.Fatalf("Invalid -currency %q (want a code such as EUR)", *currencyCode)
+		}
+		if _, ok := rates[reportCode]; !ok {
+			rates[reportCode] = 1 // the rates are in units of the reporting currency
+		}
+		opts.Currency, opts.Rates = reportCode, rates
+	}
+	portfolio, err := stockopt.Load(inputPaths, opts)
+	if err != nil {
+		log.Fatalf("Reading statement: %v", err)
+	}
+	currencies := portfolio.Currencies()
+	if *currencyCode == "" {
+		if len(currencies) > 1 {
+			log.Fatalf("The statements are in several currencies (%s); use -currency to choose one for reporting",
+				strings.Join(currencies, ", "))
+		}
+		reportCode = currencies[0]
+		if _, ok := rates[reportCode]; !ok {
+			rates[reportCode] = 1
+		}
+	}
+	if err := symbolGains.convert(); err != nil {
+		log.Fatalf("Invalid -symbol-gain: %v", err)
+	} else if err := gainRange.convert(); err != nil {
+		log.Fatalf("Invalid -gain-range: %v", err)
+	} else if err := marketRange.convert(); err != nil {
+		log.Fatalf("Invalid -market-range: %v", err)
+	}
+
+	// Convert the capital gains cap into a currency value.
+	maxGain, err := parseAmount(*capGainLimit)
+	if err != nil {
+		log.Fatalf("Invalid cap %q: %v", *capGainLimit, err)
+	}
+	termCaps := isSet("gain-long") || isSet("gain-short")
+	maxLong, err := parseAmount(*longGainCap)
+	if err != nil {
+		log.Fatalf("Invalid long-term cap %q: %v", *longGainCap, err)
+	}
+	maxShort, err := parseAmount(*shortGainCap)
+	if err != nil {
+		log.Fatalf("Invalid short-term cap %q: %v", *shortGainCap, err)
+	}
+	if termCaps && !isSet("gain") {
+		// Without an overall cap, the total is bounded only by the term caps.
+		maxGain = maxLong + maxShort
+	}
+	market, err := parseAmount(*marketPrice)
+	if err != nil {
+		log.Fatalf("Invalid market price %q: %v", *marketPrice, err)
+	}
+	for _, alias := range sortedKeys(flagAliases) {
+		if name := flagAliases[alias]; isSetExactly(name) && isSetExactly(alias) {
+			log.Fatalf("Use either -%s or -%s, not both", name, alias)
+		}
+	}
+	target, err := parseAmount(*raiseTarget)
+	if err != nil {
+		log.Fatalf("Invalid proceeds target %q: %v", *raiseTarget, err)
+	}
+	harvest, err := parseAmount(*harvestLoss)
+	if err != nil {
+		log.Fatalf("Invalid harvest target %q: %v", *harvestLoss, err)
+	}
+	var have, need currency.Value
+	if isSet("need-cash") || isSet("have-cash") {
+		if isSet("raise") {
+			log.Fatal("Use either -raise or -need-cash and -have-cash, not both")
+		}
+		if have, err = parseAmount(*haveCash); err != nil {
+			log.Fatalf("Invalid cash on hand %q: %v", *haveCash, err)
+		}
+		if need, err = parseAmount(*needCash); err != nil {
+			log.Fatalf("Invalid cash needed %q: %v", *needCash, err)
+		}
+		if need <= have {
+			fmt.Printf("No sale needed: cash on hand %s covers the %s needed\n", have.Format(reportCode), need.Format(reportCode))
+			return
+		}
+		target = need - have
+	}
+	maxTax, err := parseAmount(*taxLimit)
+	if err != nil {
+		log.Fatalf("Invalid tax limit %q: %v", *taxLimit, err)
+	}
+	today := time.Now()
+	saleDate := today
+	if *saleDateFlag != "" {
+		saleDate, err = time.Parse(statement.DateFormat, *saleDateFlag)
+		if err != nil {
+			log.Fatalf("Invalid sale date %q: %v", *saleDateFlag, err)
+		}
+	}
+	historical := saleDate.Format(statement.DateFormat) < today.Format(statement.DateFormat)
+	switch *objective {
+	case "":
+		*objective = "max-value"
+		if target > 0 {
+			*objective = "min-gain"
+		} else if harvest > 0 {
+			*objective = "harvest"
+		}
+	case "max-value", "value-then-compact":
+	case "min-gain":
+		if target <= 0 {
+			log.Fatal("The min-gain objective requires a positive -raise target")
+		}
+	case "harvest":
+		if harvest <= 0 {
+			log.Fatal("The harvest objective requires a positive -harvest target")
+		}
+	default:
+		log.Fatalf("Unknown -objective %q", *objective)
+	}
+	if *maxGainRatio < 0 {
+		log.Fatal("The -max-gain-ratio must not be negative")
+	} else if *maxGainRatio > 0 && *objective != "min-gain" {
+		log.Fatal("The -max-gain-ratio option requires a -raise target")
+	} else if *compareFIFO && *objective == "min-gain" {
+		log.Fatal("The -compare-fifo option requires a -gain cap, not -raise")
+	} else if *maxRows < 0 {
+		log.Fatal("The -max-rows must not be negative")
+	} else if !(*maxLotFrac >= 0 && *maxLotFrac <= 1) {
+		log.Fatal("The -max-lot-fraction must be between 0 and 1")
+	} else if maxTax > 0 && isSet("stax") {
+		log.Fatal("The -max-tax option cannot be combined with -stax")
+	} else if maxTax > 0 && *objective == "min-gain" {
+		log.Fatal("The -max-tax option cannot be combined with -raise")
+	} else if isSet("gain") && *objective == "min-gain" {
+		log.Fatal("The -gain cap cannot be combined with a -raise target")
+	} else if termCaps && *objective == "min-gain" {
+		log.Fatal("The -gain-long and -gain-short options cannot be combined with -raise")
+	} else if *objective == "harvest" && (target > 0 || isSet("gain") || termCaps || maxTax > 0 || *compareFIFO) {
+		log.Fatal("The -harvest option cannot be combined with -raise, -gain, term caps, -max-tax, or -compare-fifo")
+	} else if harvest > 0 && *objective != "harvest" {
+		log.Fatalf("The -harvest option cannot be used with -objective %s", *objective)
+	}
+	if *objective == "harvest" {
+		*allowLoss = true // harvesting sells only lots with a loss
+	}
+	if *exactSearch && *objective == "harvest" {
+		log.Fatalf("The -exact option cannot be used with -objective %s", *objective)
+	}
+	var yearCap currency.Value
+	if isSet("years") || isSet("annual-gain") {
+		if *planYears < 1 || !isSet("annual-gain") {
+			log.Fatal("A multi-year plan requires -years of at least 1 and an -annual-gain cap")
+		} else if yearCap, err = parseAmount(*annualGain); err != nil {
+			log.Fatalf("Invalid annual cap %q: %v", *annualGain, err)
+		} else if *objective != "max-value" && *objective != "value-then-compact" {
+			log.Fatalf("The -years option cannot be used with -objective %s", *objective)
+		} else if isSet("gain") || termCaps || maxTax > 0 || isSet("stax") || *compareFIFO || *washSale {
+			log.Fatal("The -years option cannot be combined with -gain, term caps, -max-tax, -stax, -compare-fifo, or -wash-sale")
+		} else if *outputMode != "text" {
+			log.Fatal("The -years option requires -output text")
+		}
+	}
+	sweeping := isSet("gain-range") || isSet("market-range")
+	if sweeping {
+		if *objective != "max-value" && *objective != "value-then-compact" {
+			log.Fatalf("A sweep cannot be used with -objective %s", *objective)
+		} else if isSet("gain-range") && (isSet("gain") || maxTax > 0) {
+			log.Fatal("The -gain-range option cannot be combined with -gain or -max-tax")
+		} else if isSet("market-range") && (isSet("market") || *liveQuote || *tickerSymbol != "") {
+			log.Fatal("The -market-range option cannot be combined with -market or -live")
+		} else if isSet("market-range") && marketRange.Lo <= 0 {
+			log.Fatal("The -market-range prices must be positive")
+		} else if *planYears > 0 || *compareFIFO || *washSale || *printSummary {
+			log.Fatal("A sweep cannot be combined with -years, -compare-fifo, -wash-sale, or -summary")
+		} else if *outputMode != "text" {
+			log.Fatal("A sweep requires -output text")
+		}
+	} else if *bestAfterTax {
+		log.Fatal("The -best-after-tax option requires -gain-range or -market-range")
+	}
+	if *commitSale && (sweeping || *planYears > 0 || *printSummary) {
+		log.Fatal("The -commit option requires a single sale profile, not a sweep, -years, or -summary")
+	}
+	switch *outputMode {
+	case "text":
+	case "json", "csv":
+		if *compareFIFO {
+			log.Fatalf("The -compare-fifo option cannot be used with -output %s", *outputMode)
+		} else if *washSale {
+			log.Fatalf("The -wash-sale option cannot be used with -output %s", *outputMode)
+		}
+	case "tax8949", "canonical":
+		if *printSummary || *compareFIFO {
+			log.Fatalf("The -output %s format requires a sale profile", *outputMode)
+		} else if *washSale {
+			log.Fatalf("The -wash-sale option cannot be used with -output %s", *outputMode)
+		}
+	default:
+		log.Fatalf("Unknown -output format %q", *outputMode)
+	}
+
+	// At a flat tax rate, a limit on the tax is equivalent to a cap on gains.
+	// If both are given, the lower cap applies.
+	taxBound := false
+	if maxTax > 0 {
+		if *taxRate <= 0 {
+			log.Fatal("The -max-tax option requires a positive -tax rate")
+		}
+		taxCap := currency.Value(math.Floor(float64(maxTax) * 100 / *taxRate))
+		if !isSet("gain") || taxCap < maxGain {
+			maxGain, taxBound = taxCap, true
+		}
+	}
+
+	// Unless -age is set, only entries whose sale would be long-term qualify.
+	oldEnoughOn := func(e *statement.Entry, date time.Time) bool {
+		return e.Acquired.Before(date.AddDate(0, -*ageMonths, 0))
+	}
+	minAge := fmt.Sprintf("%d months", *ageMonths)
+	if isSet("stax") && !isSet("age") {
+		// Short-term lots are taxed at their own rate, so all lots qualify.
+		oldEnoughOn = func(*statement.Entry, time.Time) bool { return true }
+		minAge = "none (short-term gains taxed at -stax rate)"
+	} else if isSet("gain-short") && !isSet("age") {
+		// Short-term gains are budgeted separately, so all lots qualify.
+		oldEnoughOn = func(*statement.Entry, time.Time) bool { return true }
+		minAge = "none (short-term gains capped separately)"
+	} else if !isSet("age") {
+		oldEnoughOn = (*statement.Entry).IsLongTerm
+		minAge = "long-term (held more than " + longTerm.String() + ")"
+	}
+
+	if *liveQuote || *tickerSymbol != "" {
+		if isSet("market") {
+			log.Fatal("Use either -market or -live, not both")
+		} else if historical {
+			log.Fatal("The -live option cannot be used with a past -date")
+		}
+		symbol := *tickerSymbol
+		if first := portfolio.Statements[0]; symbol == "" && first.Meta.Symbol == "" {
+			log.Fatalf("Statement %q does not name a security; use -ticker to give its symbol", first.Name)
+		} else if symbol == "" {
+			symbol = first.Meta.Symbol
+		}
+		market = fetchQuote(symbol)
+	}
+	var values map[int]currency.Value
+	if *valuesPath != "" {
+		if values, err = readValues(*valuesPath); err != nil {
+			log.Fatalf("Reading values: %v", err)
+		}
+	}
+
+	for _, s := range portfolio.Statements {
+		if !s.Meta.AsOf.IsZero() && maxStale.AddTo(s.Meta.AsOf).Before(today) {
+			warnf("Statement %q is dated %s, more than %s ago", s.Name,
+				s.Meta.AsOf.Format(statement.DateFormat), maxStale)
+		}
+	}
+	if sales != nil {
+		// Shares sold after the date of a statement are not reflected in it.
+		for _, s := range portfolio.Statements {
+			if n := sales.Apply(s.Lots, s.Meta.AsOf); n > 0 {
+				log.Printf("Excluded %d shares committed to %q from statement %q", n, *statePath, s.Name)
+			}
+		}
+	}
+	symbols := portfolio.Symbols()
+	if market > 0 && len(symbols) > 1 {
+		log.Fatal("The -market option cannot be used with statements for several securities")
+	}
+
+	var limits []solver.Limit
+	if termCaps {
+		isLong := func(e solver.Entry) bool { return e.LongTerm }
+		limits = append(limits, solver.Limit{
+			Name: "gain-long", Cap: maxLong, Applies: isLong,
+		}, solver.Limit{
+			Name: "gain-short", Cap: maxShort, Applies: func(e solver.Entry) bool { return !isLong(e) },
+		})
+	}
+	for _, sym := range sortedKeys(symbolGains) {
+		sym := sym
+		limits = append(limits, solver.Limit{
+			Name: "gain-cap:" + sym,
+			Cap:  symbolGains[sym].Value,
+			Applies: func(e solver.Entry) bool {
+				return e.ID.(*statement.Entry).Symbol == sym
+			},
+		})
+	}
+	c := &stockopt.Constraints{
+		SaleDate:       saleDate,
+		Objective:      stockopt.Objective(*objective),
+		GainsCap:       maxGain,
+		Proceeds:       target,
+		MaxGainRatio:   *maxGainRatio,
+		Loss:           harvest,
+		Limits:         limits,
+		MinAge:         oldEnoughOn,
+		Plan:           *planFilter,
+		HoldPeriods:    planHold,
+		AllowLoss:      *allowLoss,
+		MaxLotFraction: *maxLotFrac,
+		MarketPrice:    market,
+		Values:         values,
+		TaxRate:        *taxRate,
+		TaxShortTerm:   isSet("stax"),
+		ShortTaxRate:   *shortTaxRate,
+		Years:          *planYears,
+		AnnualCap:      yearCap,
+		Exact:          *exactSearch,
+	}
+	if !isSet("plan") {
+		// The default plan filter names an MSSB plan, so it applies only to
+		// MSSB statements.
+		c.PlanFormats = []statement.Format{statement.MSSB}
+	}
+
+	// Select the lots eligible for sale: those with available shares, issued
+	// before the specified age, and matching the specified plan filter.
+	plan := stockopt.Select(portfolio, c)
+	for _, w := range plan.Warnings {
+		log.Printf("Warning: %s", w)
+	}
+	es, held := plan.Lots, plan.Held
+	if market > 0 && !*forceMarket {
+		checkMarket(es, market)
+	}
+
+	// Compute the total value of the portfolio, just for cosmetics. Since
+	// these totals are for display only, they saturate rather than overflow.
+	var totalValue, totalGain, totalBasis currency.Value
+	var totalShares int
+	var sat bool
+	for _, e := range es {
+		totalShares += e.Available
+		totalValue = totalValue.AddSat(e.Price.MulIntSat(e.Available, &sat), &sat)
+		totalGain = totalGain.AddSat(e.Gain.MulIntSat(e.Available, &sat), &sat)
+		totalBasis = totalBasis.AddSat(e.IssuePrice.MulIntSat(e.Available, &sat), &sat)
+	}
+	if sat {
+		log.Print("Warning: portfolio totals are too large to represent and are approximate")
+	}
+
+	// The human-readable header is only printed for text output.
+	var textOut io.Writer = os.Stdout
+	if *outputMode != "text" {
+		textOut = io.Discard
+	}
+
+	for _, path := range inputPaths {
+		fmt.Fprintf(textOut, "Input file:   %q\n", path)
+	}
+	if len(symbols) != 0 {
+		fmt.Fprintf(textOut, "Security:      %s\n", strings.Join(symbols, ", "))
+	}
+	fmt.Fprintf(textOut, "Currency:      %s", strings.Join(currencies, ", "))
+	if len(currencies) != 1 || currencies[0] != reportCode {
+		fmt.Fprintf(textOut, " (reported in %s)", reportCode)
+	}
+	fmt.Fprintf(textOut, `
+Sale date:     %s
+Minimum age:   %s
+`, saleDate.Format(statement.DateFormat), minAge)
+	if historical {
+		fmt.Fprintln(textOut, "Scenario:      historical")
+		if market <= 0 && !isSet("market-range") {
+			log.Print("Warning: historical scenario without -market uses the statement price")
+		}
+	}
+	if *objective == "harvest" {
+		fmt.Fprintf(textOut, "Harvest target: %s\n", harvest.Format(reportCode))
+	} else if *objective == "min-gain" {
+		if need > 0 {
+			fmt.Fprintf(textOut, "Cash needed:   %s\nCash on hand:  %s\nShortfall:     %s\n",
+				need.Format(reportCode), have.Format(reportCode), target.Format(reportCode))
+		} else {
+			fmt.Fprintf(textOut, "Raise target:  %s\n", target.Format(reportCode))
+		}
+	} else if *planYears > 0 {
+		fmt.Fprintf(textOut, "Annual cap:    %s for %d years\n", yearCap.Format(reportCode), *planYears)
+	} else if isSet("gain-range") {
+		fmt.Fprintf(textOut, "Gains caps:    %s to %s by %s\n", gainRange.Lo.Format(reportCode), gainRange.Hi.Format(reportCode), gainRange.Step.Format(reportCode))
+	} else {
+		fmt.Fprintf(textOut, "Gains cap:     %s\n", maxGain.Format(reportCode))
+		if termCaps {
+			fmt.Fprintf(textOut, "  %-12s %s\n  %-12s %s\n", "long-term:", maxLong.Format(reportCode), "short-term:", maxShort.Format(reportCode))
+		}
+		for _, sym := range sortedKeys(symbolGains) {
+			fmt.Fprintf(textOut, "  %-12s %s\n", sym+":", symbolGains[sym].Value.Format(reportCode))
+		}
+	}
+	if maxTax > 0 {
+		fmt.Fprintf(textOut, "Tax limit:     %s at %g%%\n", maxTax.Format(reportCode), *taxRate)
+	}
+	fmt.Fprintf(textOut, `Allow loss:    %v
+Total shares:  %d
+Cost basis:    %s
+Present value: %s
+Total gains:   %s
+`, *allowLoss, totalShares, totalBasis.Format(reportCode), totalValue.Format(reportCode), totalGain.Format(reportCode))
+	if isSet("market-range") {
+		fmt.Fprintf(textOut, "Market prices: %s to %s by %s\n", marketRange.Lo.Format(reportCode), marketRange.Hi.Format(reportCode), marketRange.Step.Format(reportCode))
+	} else if market > 0 {
+		fmt.Fprintf(textOut, "Market price:  %s\n", market.Format(reportCode))
+	}
+	if len(held) != 0 {
+		fmt.Fprintln(textOut, "\nExcluded by plan holding period:")
+		for _, e := range held {
+			fmt.Fprintf(textOut, "  %s -- sellable %s\n", e.Format(-1),
+				planHold[e.Plan].AddTo(e.Acquired).Format(statement.DateFormat))
+		}
+	}
+
+	params := report.Params{
+		MinAge:   minAge,
+		TaxRate:  *taxRate,
+		SaleDate: saleDate.Format(statement.DateFormat),
+		Currency: reportCode,
+	}
+	if *objective == "min-gain" {
+		params.RaiseTarget = target.Format(reportCode)
+	} else if *objective == "harvest" {
+		params.HarvestTarget = harvest.Format(reportCode)
+	} else {
+		params.GainsCap = maxGain.Format(reportCode)
+	}
+	if market > 0 {
+		params.MarketPrice = market.Format(reportCode)
+	}
+	if isSet("stax") {
+		params.ShortRate = *shortTaxRate
+	}
+
+	// If requested, print a summary of available shares.
+	if *printSummary && *outputMode != "text" {
+		avail := make([]solver.Entry, len(es))
+		for i, e := range es {
+			avail[i] = solver.Entry{
+				ID: e, N: e.Available, Value: e.Price, Gain: e.Gain,
+				LongTerm: e.IsLongTerm(saleDate), TaxRate: c.LotTaxRate(e, saleDate),
+			}
+		}
+		params.Summary = true
+		plan.Result = &solver.Result{Entries: avail}
+		writePlan(plan, params)
+		return
+	} else if *printSummary {
+		fmt.Fprintln(textOut, "\nAvailable shares:")
+		for _, e := range es {
+			fmt.Fprintf(textOut, "%2d. %s\n", e.Index, e.Format(-1))
+		}
+		return
+	}
+
+	if *maxLotFrac > 0 {
+		fmt.Fprintf(textOut, "\nPer-lot ceilings (%g of each lot):\n", *maxLotFrac)
+		for _, e := range es {
+			fmt.Fprintf(textOut, "  [lot %2d] %d of %d shares\n", e.Index, c.LotCeiling(e), e.Available)
+		}
+	}
+
+	fmt.Fprintln(textOut)
+	if *dumpInput {
+		fmt.Fprintln(textOut, "Solver input:")
+		for _, elt := range plan.Input {
+			fmt.Fprintf(textOut, "  [lot %2d] N=%d Value=%s (%v) Gain=%s (%v)\n",
+				elt.ID.(*statement.Entry).Index, elt.N,
+				elt.Value.Format(reportCode), elt.Value, elt.Gain.Format(reportCode), elt.Gain)
+		}
+		fmt.Fprintln(textOut)
+	}
+	if sweeping {
+		scs, err := sweep(portfolio, c)
+		if err != nil {
+			log.Fatalf("Planning sale: %v", err)
+		}
+		printSweep(os.Stdout, scs, *bestAfterTax)
+		return
+	}
+	if err := plan.Solve(); errors.Is(err, stockopt.ErrGainRatio) {
+		log.Fatalf("Unable to raise %s with a gain ratio of at most %g",
+			target.Format(reportCode), *maxGainRatio)
+	} else if err != nil {
+		log.Fatalf("Planning sale: %v", err)
+	}
+	if *planYears > 0 {
+		printSchedule(plan.Schedule, plan.Dates, totalShares)
+		return
+	}
+	soln := plan.Result.Entries
+	if *objective == "harvest" {
+		if loss := -stockopt.Summarize(soln).Gains; loss < harvest {
+			log.Printf("Warning: unable to harvest %s; selling all eligible lots with a loss realizes only %s",
+				harvest.Format(reportCode), loss.Format(reportCode))
+		}
+		writePlan(plan, params)
+		commit(sales, plan)
+		if *washSale {
+			printWashSales(os.Stdout, stockopt.WashSales(soln, plan.Replacements, saleDate))
+		}
+		return
+	}
+	if *objective == "min-gain" {
+		if v := stockopt.Summarize(soln).Value; v < target {
+			log.Printf("Warning: unable to raise %s; selling all available shares raises only %s",
+				target.Format(reportCode), v.Format(reportCode))
+		}
+		writePlan(plan, params)
+		commit(sales, plan)
+		if *washSale {
+			printWashSales(os.Stdout, stockopt.WashSales(soln, plan.Replacements, saleDate))
+		}
+		return
+	}
+	writePlan(plan, params)
+	commit(sales, plan)
+	if *outputMode != "text" {
+		return
+	}
+	if maxTax > 0 {
+		// Report which limit bounded the plan: if every lot was sold to its
+		// ceiling, the cap did not bind.
+		bound := "gains cap"
+		if soldToCeiling(&plan.Constraints, plan.Input, soln) {
+			bound = "available shares"
+		} else if taxBound {
+			bound = "tax limit"
+		}
+		fmt.Printf("Bounded by:\t%s\n", bound)
+	}
+	if *washSale {
+		printWashSales(os.Stdout, stockopt.WashSales(soln, plan.Replacements, saleDate))
+	}
+	if *compareFIFO {
+		printComparison(&plan.Constraints, soln, plan.FIFO())
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseAmount parses an amount given on the command line or in an input file,
+// and converts it to the reporting currency.
+func parseAmount(s string) (currency.Value, error) {
+	a, err := currency.ParseAmount(s)
+	if err != nil {
+		return 0, err
+	}
+	return toReport(a)
+}
+
+// toReport converts a to the reporting currency at the -rate exchange rates.
+// An amount with no currency, or of zero, is taken as it is.
+func toReport(a currency.Amount) (currency.Value, error) {
+	if a.Code == "" || a.Value == 0 {
+		return a.Value, nil
+	}
+	v, err := rates.Convert(a.Value, a.Code, reportCode)
+	if errors.Is(err, currency.ErrNoRate) {
+		return 0, fmt.Errorf("converting %s to %s: %w (use -rate to give one)", a, reportCode, err)
+	}
+	return v, err
+}
+
+// readRates adds the exchange rates in the CSV file at path to the -rate table.
+func readRates(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return rates.ReadRates(f)
+}
+
+// readValues reads a CSV file of lot numbers and values per share from path.
+// A first row whose lot number is not an integer is treated as a header.
+func readValues(path string) (map[int]currency.Value, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[int]currency.Value)
+	for i, row := range rows {
+		lot, err := strconv.Atoi(strings.TrimSpace(row[0]))
+		if err != nil && i == 0 {
+			continue // header
+		} else if err != nil {
+			return nil, fmt.Errorf("row %d: invalid lot %q", i+1, row[0])
+		}
+		v, err := parseAmount(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", i+1, err)
+		} else if v <= 0 {
+			return nil, fmt.Errorf("row %d: value must be positive", i+1)
+		}
+		values[lot] = v
+	}
+	return values, nil
+}
+
+// commit records the sale profile of p in the ledger, if -commit is set.
+func commit(sales *ledger.Ledger, p *stockopt.Plan) {
+	if !*commitSale {
+		return
+	} else if len(p.Result.Entries) == 0 {
+		log.Print("No shares are sold; nothing to commit")
+		return
+	} else if err := commitPlan(sales, *statePath, p); err != nil {
+		log.Fatalf("Writing ledger: %v", err)
+	}
+	log.Printf("Committed the sale of %d shares on %s to %q", stockopt.Summarize(p.Result.Entries).Shares,
+		p.SaleDate().Format(statement.DateFormat), *statePath)
+}
+
+// splitTax reports whether separate federal and state tax rates were given.
+func splitTax() bool { return isSet("fed-tax") || isSet("state-tax") }
+
+// flagAliases maps the names of alias flags to the flags they stand for.
+var flagAliases = map[string]string{
+	"proceeds": "raise",
+	"lt-gain":  "gain-long",
+	"st-gain":  "gain-short",
+	"lt-tax":   "tax",
+	"st-tax":   "stax",
+}
+
+// isSet reports whether the named flag, or an alias for it, was set on the
+// command line.
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name || flagAliases[f.Name] == name })
+	return set
+}
+
+// isSetExactly reports whether the named flag itself was set on the command
+// line, disregarding its aliases.
+func isSetExactly(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// checkMarket warns if the market price override differs from the price stated
+// for any of the lots es by more than a factor of 10. Only the stated price
+// farthest from the market price is reported. The warning is fatal if -strict
+// is set.
+func checkMarket(es []*statement.Entry, market currency.Value) {
+	var worst currency.Value
+	var ratio float64
+	for _, e := range es {
+		if e.Stated <= 0 {
+			continue
+		}
+		r := float64(market) / float64(e.Stated)
+		if r < 1 {
+			r = 1 / r
+		}
+		if r > ratio {
+			worst, ratio = e.Stated, r
+		}
+	}
+	if ratio > 10 {
+		warnf("Market price %s is far from the statement price %s per share; "+
+			"use -force-market if this is intended", market.Format(reportCode), worst.Format(reportCode))
+	}
+}
+
+// fetchQuote returns the current price of the security with the given symbol
+// from the quote service. If the quote cannot be fetched, it logs a warning and
+// returns 0, so that the statement price is used; with -strict the failure is
+// fatal.
+func fetchQuote(symbol string) currency.Value {
+	p := &quote.HTTP{
+		URL:    cmp.Or(*quoteURL, os.Getenv("STOCKOPT_QUOTE_URL")),
+		Field:  cmp.Or(*quoteField, os.Getenv("STOCKOPT_QUOTE_FIELD")),
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.URL == "" {
+		p.URL = quote.DefaultURL
+		p.Field = cmp.Or(p.Field, quote.DefaultField)
+	}
+	price, err := p.Quote(context.Background(), symbol)
+	if err != nil {
+		warnf("Unable to fetch a quote for %s (%v); using the statement price", symbol, err)
+		return 0
+	}
+	log.Printf("Live quote for %s: %s", symbol, price.Format(reportCode))
+	return price
+}
+
+// warnf logs a warning about the input, or exits if -strict is set.
+func warnf(msg string, args ...interface{}) {
+	if *strictMode {
+		log.Fatalf("Error: "+msg, args...)
+	}
+	log.Printf("Warning: "+msg, args...)
+}
+
+// writePlan writes the sale plan in p in the selected output format. The
+// params describe the inputs to the plan, for machine-readable output.
+func writePlan(p *stockopt.Plan, params report.Params) {
+	soln := p.Result.Entries
+	sort.Slice(soln, func(i, j int) bool {
+		return statement.EntryLess(soln[i].ID.(*statement.Entry), soln[j].ID.(*statement.Entry))
+	})
+	var err error
+	switch *outputMode {
+	case "json":
+		err = report.WriteJSON(os.Stdout, p.Report(params))
+	case "csv":
+		err = report.WriteCSV(os.Stdout, p.Report(params))
+	case "tax8949":
+		err = writeTax8949(os.Stdout, soln, p.SaleDate())
+	case "canonical":
+		err = report.WriteCanonical(os.Stdout, p.Report(params))
+	default:
+		printPlan(p)
+	}
+	if err != nil {
+		log.Fatalf("Writing output: %v", err)
+	}
+}
+
+// printPlan prints the lots sold by p and the totals of the sale.
+// If -max-rows is set, only that many lots are listed, but the totals reflect
+// the whole plan.
+func printPlan(p *stockopt.Plan) {
+	soln := p.Result.Entries
+	for i, elt := range soln {
+		if *maxRows > 0 && i == *maxRows {
+			fmt.Printf("... and %d more lots\n", len(soln)-i)
+			break
+		}
+		e := elt.ID.(*statement.Entry)
+		if isSet("stax") {
+			term := "ST"
+			if elt.LongTerm {
+				term = "LT"
+			}
+			fmt.Printf("Sell [lot %2d] %s: %s\n", e.Index, term, e.Format(elt.N))
+			continue
+		}
+		fmt.Printf("Sell [lot %2d]: %s\n", e.Index, e.Format(elt.N))
+	}
+
+	sum := stockopt.Summarize(soln)
+	fmt.Printf("\nSold shares:\t%d\nSold value:\t%s\nSold gains:\t%s\nCost basis:\t%s\n",
+		sum.Shares, sum.Value.Format(reportCode), sum.Gains.Format(reportCode), sum.Basis.Format(reportCode))
+	if pct, ok := sum.GainPercent(); ok {
+		fmt.Printf("Realized gain:\t%.1f%% of cost basis\n", pct)
+	}
+	if len(symbolGains) != 0 {
+		bySymbol := make(map[string]currency.Value)
+		for _, elt := range soln {
+			bySymbol[elt.ID.(*statement.Entry).Symbol] += elt.Gain * currency.Value(elt.N)
+		}
+		for _, sym := range sortedKeys(bySymbol) {
+			label := sym
+			if label == "" {
+				label = "(unknown)"
+			}
+			fmt.Printf("  %s gains:\t%s", label, bySymbol[sym].Format(reportCode))
+			if cap, ok := symbolGains[sym]; ok {
+				fmt.Printf(" of %s", cap.Value.Format(reportCode))
+			}
+			fmt.Println()
+		}
+	}
+	if isSet("gain-long") || isSet("gain-short") {
+		var long, short currency.Value
+		for _, elt := range soln {
+			if elt.LongTerm {
+				long += elt.Gain * currency.Value(elt.N)
+			} else {
+				short += elt.Gain * currency.Value(elt.N)
+			}
+		}
+		// The caps were validated when the flags were parsed.
+		maxLong, _ := parseAmount(*longGainCap)
+		maxShort, _ := parseAmount(*shortGainCap)
+		fmt.Printf("  Long-term:\t%s of %s\n", long.Format(reportCode), maxLong.Format(reportCode))
+		fmt.Printf("  Short-term:\t%s of %s\n", short.Format(reportCode), maxShort.Format(reportCode))
+	}
+	if *maxGainRatio > 0 && sum.Value > 0 {
+		fmt.Printf("Gain ratio:\t%.4f (max %g)\n", float64(sum.Gains)/float64(sum.Value), *maxGainRatio)
+	}
+	if isSet("stax") {
+		tax := p.Constraints.Tax(soln)
+		fmt.Printf("Gains tax:\t%s (%g%% long-term, %g%% short-term)\n", tax.Format(reportCode), *taxRate, *shortTaxRate)
+		fmt.Printf("After-tax value:\t%s\n", (sum.Value - tax).Format(reportCode))
+	} else if splitTax() {
+		fed, state := sum.Gains.Percent(*fedTaxRate), sum.Gains.Percent(*stateTaxRate)
+		fmt.Printf("%g%% federal tax:\t%s\n", *fedTaxRate, fed.Format(reportCode))
+		fmt.Printf("%g%% state tax:\t%s\n", *stateTaxRate, state.Format(reportCode))
+		fmt.Printf("%g%% gains tax:\t%s\n", *taxRate, (fed + state).Format(reportCode))
+	} else if *taxRate > 0 {
+		tax := sum.Gains.Percent(*taxRate)
+		fmt.Printf("%g%% gains tax:\t%s\n", *taxRate, tax.Format(reportCode))
+	}
+	if d := p.Result.Diagnostics; d != nil {
+		printDiagnostics(os.Stdout, d)
+	}
+}
+
+// printSchedule prints the lots sold in each year of a multi-year plan, with
+// the proceeds, gains, and estimated tax of each year and of the whole plan.
+func printSchedule(plans [][]solver.Entry, dates []time.Time, totalShares int) {
+	var all []solver.Entry
+	for y, soln := range plans {
+		sort.Slice(soln, func(i, j int) bool {
+			return statement.EntryLess(soln[i].ID.(*statement.Entry), soln[j].ID.(*statement.Entry))
+		})
+		fmt.Printf("Year %d (sale date %s):\n", y+1, dates[y].Format(statement.DateFormat))
+		for _, elt := range soln {
+			e := elt.ID.(*statement.Entry)
+			fmt.Printf("  Sell [lot %2d]: %s\n", e.Index, e.Format(elt.N))
+		}
+		sum := stockopt.Summarize(soln)
+		fmt.Printf("  Proceeds: %s  Gains: %s  Tax: %s\n\n",
+			sum.Value.Format(reportCode), sum.Gains.Format(reportCode), sum.Gains.Percent(*taxRate).Format(reportCode))
+		all = append(all, soln...)
+	}
+	sum := stockopt.Summarize(all)
+	fmt.Printf("Sold shares:\t%d of %d\nSold value:\t%s\nSold gains:\t%s\n%g%% gains tax:\t%s\n",
+		sum.Shares, totalShares, sum.Value.Format(reportCode), sum.Gains.Format(reportCode), *taxRate, sum.Gains.Percent(*taxRate).Format(reportCode))
+}
+
+// soldToCeiling reports whether soln sells every lot of the solver input to
+// its ceiling under c, apart from lots at a loss that c does not allow.
+func soldToCeiling(c *stockopt.Constraints, input, soln []solver.Entry) bool {
+	sold := make(map[*statement.Entry]int)
+	for _, elt := range soln {
+		sold[elt.ID.(*statement.Entry)] += elt.N
+	}
+	for _, elt := range input {
+		e := elt.ID.(*statement.Entry)
+		if elt.Gain < 0 && !c.AllowLoss {
+			continue
+		} else if sold[e] < c.LotCeiling(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// printComparison prints the totals of the specific-lot sale plan in soln
+// alongside those of the first-in, first-out plan in fifo, with the tax on
+// the gains of each at the rates of c.
+func printComparison(c *stockopt.Constraints, soln, fifo []solver.Entry) {
+	a, b := stockopt.Summarize(soln), stockopt.Summarize(fifo)
+	fmt.Printf("\n%-14s%14s%14s%14s\n", "", "Specific lot", "FIFO", "Difference")
+	row := func(label string, x, y currency.Value) {
+		fmt.Printf("%-14s%14s%14s%14s\n", label, x.Format(reportCode), y.Format(reportCode), (x - y).Format(reportCode))
+	}
+	fmt.Printf("%-14s%14d%14d%14d\n", "Sold shares:", a.Shares, b.Shares, a.Shares-b.Shares)
+	row("Sold value:", a.Value, b.Value)
+	row("Sold gains:", a.Gains, b.Gains)
+	if c.TaxRate > 0 || (c.TaxShortTerm && c.ShortTaxRate > 0) {
+		row("Gains tax:", c.Tax(soln), c.Tax(fifo))
+	}
+}
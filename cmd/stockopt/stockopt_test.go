@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/statement"
+)
+
+func TestFetchQuote(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() { log.SetOutput(os.Stderr); log.SetFlags(log.LstdFlags) })
+	t.Setenv("STOCKOPT_QUOTE_URL", "")
+	t.Setenv("STOCKOPT_QUOTE_FIELD", "")
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   currency.Value // 0 means the statement price is used
+		log    string         // a substring of the log
+	}{
+		{"OK", http.StatusOK, `{"price": 1500.25}`, 1500*currency.Dollars + 25*currency.Cents, "Live quote for GOOG"},
+		{"Unavailable", http.StatusServiceUnavailable, "try later", 0, "using the statement price"},
+		{"Malformed", http.StatusOK, `{"price": "soon"}`, 0, "using the statement price"},
+		{"Negative", http.StatusOK, `{"price": -3}`, 0, "using the statement price"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+			*quoteURL, *quoteField = srv.URL+"/{symbol}", "price"
+			defer func() { *quoteURL, *quoteField = "", "" }()
+
+			buf.Reset()
+			if got := fetchQuote("GOOG"); got != tc.want {
+				t.Errorf("fetchQuote: got %v, want %v", got, tc.want)
+			}
+			if !strings.Contains(buf.String(), tc.log) {
+				t.Errorf("fetchQuote: log %q does not contain %q", buf.String(), tc.log)
+			}
+		})
+	}
+}
+
+func TestCheckMarket(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() { log.SetOutput(os.Stderr); log.SetFlags(log.LstdFlags) })
+
+	lots := func(prices ...currency.Value) []*statement.Entry {
+		var es []*statement.Entry
+		for _, p := range prices {
+			es = append(es, &statement.Entry{Stated: p})
+		}
+		return es
+	}
+	const usd = currency.Dollars
+	tests := []struct {
+		name   string
+		es     []*statement.Entry
+		market currency.Value
+		want   string // the statement price in the warning, or "" for none
+	}{
+		{"Close", lots(1500*usd, 1400*usd), 1450 * usd, ""},
+		{"Factor", lots(100*usd, 1000*usd), 1000 * usd, ""},
+		{"TooHigh", lots(1500 * usd), 20000 * usd, "$1500.00"},
+		{"TooLow", lots(1500 * usd), 100 * usd, "$1500.00"},
+
+		// Every lot is checked, not only the first, and the farthest price
+		// is reported.
+		{"LaterLot", lots(1500*usd, 90*usd), 1000 * usd, "$90.00"},
+		{"Worst", lots(0, 20000*usd, 1500*usd, 30000*usd), 1000 * usd, "$30000.00"},
+		{"NoStated", lots(0, 0), 1000 * usd, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			checkMarket(tc.es, tc.market)
+			got := buf.String()
+			if tc.want == "" && got != "" {
+				t.Errorf("checkMarket: unexpected warning %q", got)
+			} else if want := "the statement price " + tc.want + " per share"; tc.want != "" && !strings.Contains(got, want) {
+				t.Errorf("checkMarket: got %q, want warning for %s", got, tc.want)
+			}
+		})
+	}
+}
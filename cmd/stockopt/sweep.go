@@ -0,0 +1,173 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/creachadair/stockopt"
+	"github.com/creachadair/stockopt/currency"
+)
+
+// maxScenarios is the maximum number of scenarios in a sweep.
+const maxScenarios = 1000
+
+// valueRange is an inclusive range of amounts, stepping from Lo to Hi. It
+// implements flag.Value, accepting "lo:hi:step" arguments.
+type valueRange struct {
+	Lo, Hi, Step currency.Value
+	Code         string // the currency of the amounts, or "" if unstated
+}
+
+func (r *valueRange) String() string {
+	if r.Step == 0 {
+		return ""
+	}
+	return r.Lo.Format(r.Code) + ":" + r.Hi.Format(r.Code) + ":" + r.Step.Format(r.Code)
+}
+
+func (r *valueRange) Set(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid range %q (want lo:hi:step)", s)
+	}
+	var vs [3]currency.Value
+	var code string
+	for i, p := range parts {
+		a, err := currency.ParseAmount(p)
+		if err != nil {
+			return err
+		} else if a.Code != "" && code != "" && a.Code != code {
+			return fmt.Errorf("invalid range %q: amounts in both %s and %s", s, code, a.Code)
+		}
+		vs[i], code = a.Value, cmp.Or(a.Code, code)
+	}
+	if vs[2] <= 0 {
+		return fmt.Errorf("invalid range %q: step must be positive", s)
+	} else if vs[0] > vs[1] {
+		return fmt.Errorf("invalid range %q: low end exceeds high end", s)
+	}
+	nr := valueRange{Lo: vs[0], Hi: vs[1], Step: vs[2], Code: code}
+	if nr.count() > maxScenarios {
+		return fmt.Errorf("invalid range %q: more than %d steps", s, maxScenarios)
+	}
+	*r = nr
+	return nil
+}
+
+// convert converts the amounts of r to the reporting currency, if r is set.
+func (r *valueRange) convert() error {
+	if r.Step == 0 {
+		return nil
+	}
+	for _, v := range []*currency.Value{&r.Lo, &r.Hi, &r.Step} {
+		c, err := toReport(currency.Amount{Value: *v, Code: r.Code})
+		if err != nil {
+			return err
+		}
+		*v = c
+	}
+	if r.Step <= 0 {
+		return fmt.Errorf("the step %s is too small", r.Step.Format(reportCode))
+	}
+	r.Code = reportCode
+	return nil
+}
+
+// count returns the number of amounts of r, or 1 if r is not set. The
+// difference of the ends is taken unsigned, so it does not overflow.
+func (r *valueRange) count() uint64 {
+	if r.Step == 0 {
+		return 1
+	}
+	return uint64(r.Hi-r.Lo)/uint64(r.Step) + 1
+}
+
+// values returns the amounts of r, or only def if r is not set.
+func (r *valueRange) values(def currency.Value) []currency.Value {
+	if r.Step == 0 {
+		return []currency.Value{def}
+	}
+	out := make([]currency.Value, r.count())
+	for i := range out {
+		out[i] = r.Lo + currency.Value(i)*r.Step
+	}
+	return out
+}
+
+// A scenario records the outcome of one plan of a sweep.
+type scenario struct {
+	Cap, Market currency.Value
+	Sum         stockopt.Summary
+	Tax         currency.Value
+}
+
+// sweep builds a plan from portfolio for each combination of the gains caps
+// and market prices of the -gain-range and -market-range flags, starting from
+// the constraints in c, and returns the outcomes. It reports an error before
+// building any plan if there are more than maxScenarios combinations.
+func sweep(portfolio *stockopt.Portfolio, c *stockopt.Constraints) ([]scenario, error) {
+	// Check each range first, so the product does not overflow.
+	g, m := gainRange.count(), marketRange.count()
+	if g > maxScenarios || m > maxScenarios || g*m > maxScenarios {
+		return nil, fmt.Errorf("the sweep has %d scenarios, more than %d", g*m, maxScenarios)
+	}
+	var out []scenario
+	for _, cap := range gainRange.values(c.GainsCap) {
+		for _, market := range marketRange.values(c.MarketPrice) {
+			sc := *c
+			sc.GainsCap, sc.MarketPrice = cap, market
+			plan, err := stockopt.Build(portfolio, &sc)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, scenario{
+				Cap:    cap,
+				Market: market,
+				Sum:    stockopt.Summarize(plan.Result.Entries),
+				Tax:    plan.Constraints.Tax(plan.Result.Entries),
+			})
+		}
+	}
+	return out, nil
+}
+
+// printSweep writes a table comparing the scenarios of a sweep. If best is
+// true, the scenario with the largest after-tax proceeds is marked, the first
+// of several such.
+func printSweep(w io.Writer, scs []scenario, best bool) {
+	bi := 0
+	for i, sc := range scs {
+		if sc.Sum.Value-sc.Tax > scs[bi].Sum.Value-scs[bi].Tax {
+			bi = i
+		}
+	}
+	byMarket := marketRange.Step != 0
+	fmt.Fprintln(w, "Scenarios:")
+	fmt.Fprintf(w, "%14s", "Gains cap")
+	if byMarket {
+		fmt.Fprintf(w, "%14s", "Market")
+	}
+	fmt.Fprintf(w, "%8s%14s%14s%14s%14s\n", "Shares", "Proceeds", "Gains", "Tax", "After tax")
+	for i, sc := range scs {
+		fmt.Fprintf(w, "%14s", sc.Cap.Format(reportCode))
+		if byMarket {
+			fmt.Fprintf(w, "%14s", sc.Market.Format(reportCode))
+		}
+		fmt.Fprintf(w, "%8d%14s%14s%14s%14s", sc.Sum.Shares, sc.Sum.Value.Format(reportCode),
+			sc.Sum.Gains.Format(reportCode), sc.Tax.Format(reportCode), (sc.Sum.Value - sc.Tax).Format(reportCode))
+		if best && i == bi {
+			fmt.Fprint(w, "  *")
+		}
+		fmt.Fprintln(w)
+	}
+	if best {
+		sc := scs[bi]
+		fmt.Fprintf(w, "\nBest after tax:\t%s with a gains cap of %s", (sc.Sum.Value - sc.Tax).Format(reportCode), sc.Cap.Format(reportCode))
+		if byMarket {
+			fmt.Fprintf(w, " at %s", sc.Market.Format(reportCode))
+		}
+		fmt.Fprintln(w)
+	}
+}
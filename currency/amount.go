@@ -0,0 +1,166 @@
+package currency
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An Amount is a value in a particular currency.
+type Amount struct {
+	Value Value
+	Code  string // the ISO 4217 code of the currency, e.g., "EUR"; empty if unstated
+}
+
+// String renders a as by Value.Format.
+func (a Amount) String() string { return a.Value.Format(a.Code) }
+
+// symbols maps currency codes to the symbols used to write their amounts.
+var symbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// Format renders c as a value in the currency with the given code. A currency
+// with a symbol is written with the symbol ($ddd.cc, €ddd.cc), and another
+// with its code following the value (ddd.cc CHF). The empty code is USD.
+func (c Value) Format(code string) string {
+	code = strings.ToUpper(code)
+	if code == "" {
+		code = "USD"
+	}
+	d := c.Decimal()
+	sym, ok := symbols[code]
+	if !ok {
+		return d + " " + code
+	} else if c < 0 {
+		return "-" + sym + d[1:]
+	}
+	return sym + d
+}
+
+// The expressions matching a currency code before or after an amount.
+var (
+	codePrefix = regexp.MustCompile(`^([A-Za-z]{3})\s*([-($€£¥\d].*)$`)
+	codeSuffix = regexp.MustCompile(`^(.*[\d)-])\s*([A-Za-z]{3})$`)
+)
+
+// ParseAmount parses a string denoting an amount of currency. The amount is
+// written as for ParseUSD, but may be marked by the symbol of a currency in
+// place of the dollar sign, as in "€1,234.56", or by a currency code before or
+// after the amount, as in "EUR 1234.56" or "1234.56 EUR". The Code of the
+// result is empty if the amount has no symbol or code.
+func ParseAmount(s string) (Amount, error) {
+	t := strings.TrimSpace(s)
+	var code string
+	if m := codePrefix.FindStringSubmatch(t); m != nil {
+		code, t = strings.ToUpper(m[1]), m[2]
+	} else if m := codeSuffix.FindStringSubmatch(t); m != nil {
+		code, t = strings.ToUpper(m[2]), m[1]
+	}
+	for c, sym := range symbols {
+		if !strings.Contains(t, sym) {
+			continue
+		} else if code != "" && code != c {
+			return Amount{}, fmt.Errorf("invalid amount %q: both %s and %s", s, sym, code)
+		}
+		code, t = c, strings.Replace(t, sym, "$", 1)
+		break
+	}
+	v, err := parseValue(t, s, "")
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{Value: v, Code: code}, nil
+}
+
+// Rates is a table of exchange rates. It maps currency codes to the value of
+// one unit of each currency in a common base currency; the base currency
+// itself has rate 1. Rates implements flag.Value, accepting repeated
+// "code=rate" arguments.
+type Rates map[string]float64
+
+func (r Rates) String() string {
+	codes := make([]string, 0, len(r))
+	for c := range r {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	for i, c := range codes {
+		codes[i] = c + "=" + strconv.FormatFloat(r[c], 'g', -1, 64)
+	}
+	return strings.Join(codes, ",")
+}
+
+func (r Rates) Set(s string) error {
+	code, rate, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("invalid exchange rate %q (want code=rate)", s)
+	}
+	return r.set(code, rate)
+}
+
+func (r Rates) set(code, rate string) error {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	f, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+	if err != nil || !(f > 0) || math.IsInf(f, 0) {
+		return fmt.Errorf("invalid exchange rate %q for %s", rate, code)
+	} else if len(code) != 3 {
+		return fmt.Errorf("invalid currency code %q", code)
+	}
+	r[code] = f
+	return nil
+}
+
+// ReadRates adds to r the exchange rates read from CSV rows of a currency code
+// and a rate. A first row whose rate is not a number is treated as a header.
+func (r Rates) ReadRates(rd io.Reader) error {
+	cr := csv.NewReader(rd)
+	cr.FieldsPerRecord = 2
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64); err != nil && i == 0 {
+			continue // header
+		}
+		if err := r.set(row[0], row[1]); err != nil {
+			return fmt.Errorf("row %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ErrNoRate is reported by Convert if a currency has no exchange rate.
+var ErrNoRate = errors.New("no exchange rate")
+
+// Convert converts v from the currency with code from to the currency with code
+// to, rounding to the nearest millicent. Codes are not case-sensitive.
+func (r Rates) Convert(v Value, from, to string) (Value, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return v, nil
+	}
+	rf, ok := r[from]
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrNoRate, from)
+	}
+	rt, ok := r[to]
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrNoRate, to)
+	}
+	f := math.Round(float64(v) * rf / rt)
+	if f >= float64(MaxValue) || f <= float64(MinValue) {
+		return 0, fmt.Errorf("converting %s from %s to %s: out of range", v.Decimal(), from, to)
+	}
+	return Value(f), nil
+}
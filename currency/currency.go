@@ -4,6 +4,7 @@ package currency
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -19,45 +20,119 @@ const (
 // Value represents a currency value
 type Value int64
 
+// The range of representable values.
+const (
+	MaxValue = Value(math.MaxInt64)
+	MinValue = Value(math.MinInt64)
+)
+
 // String renders c as a value in millicents.
 func (c Value) String() string { return fmt.Sprintf("%dm¢", int64(c)) }
 
 // USD renders c as a value in U.S. dollars ($ddd.cc).
-func (c Value) USD() string {
-	neg := c < 0
-	if neg {
-		c = -c
+func (c Value) USD() string { return c.Format("USD") }
+
+// Decimal renders c as a decimal number of whole units and cents (ddd.cc),
+// without a currency symbol.
+func (c Value) Decimal() string {
+	// The magnitude is unsigned, since -MinValue is not representable.
+	m := uint64(c)
+	if c < 0 {
+		m = -m
 	}
-	usd := c / Dollars
-	usc := (c % Dollars) / Cents
-	if neg {
-		return fmt.Sprintf("-$%d.%02d", usd, usc)
+	units := m / Dollars
+	cents := (m % Dollars) / Cents
+	if c < 0 {
+		return fmt.Sprintf("-%d.%02d", units, cents)
+	}
+	return fmt.Sprintf("%d.%02d", units, cents)
+}
+
+// Percent returns p percent of c, rounded to the nearest millicent.
+func (c Value) Percent(p float64) Value { return Value(math.Round(float64(c) * p / 100)) }
+
+// AddSat returns c + d, saturating at MaxValue or MinValue rather than
+// wrapping if the sum is out of range. If the result saturates, *sat is set to
+// true; otherwise *sat is unchanged, so one flag may track a series of
+// operations.
+//
+// Saturating arithmetic is meant for display-only aggregates, where an
+// approximate result is preferable to a wrapped one.
+func (c Value) AddSat(d Value, sat *bool) Value {
+	s := c + d
+	if c > 0 && d > 0 && s < 0 {
+		*sat = true
+		return MaxValue
+	} else if c < 0 && d < 0 && s >= 0 {
+		*sat = true
+		return MinValue
 	}
-	return fmt.Sprintf("$%d.%02d", usd, usc)
+	return s
 }
 
-// The expression matching a value in USD.
-var usd = regexp.MustCompile(`^-?\$?(\d+)(?:\.(\d+))?$`)
+// MulIntSat returns c * n, saturating at MaxValue or MinValue rather than
+// wrapping if the product is out of range. If the result saturates, *sat is
+// set to true; otherwise *sat is unchanged.
+func (c Value) MulIntSat(n int, sat *bool) Value {
+	if c == 0 || n == 0 {
+		return 0
+	}
+	p := c * Value(n)
+	if p/Value(n) != c || (c == -1 && Value(n) == MinValue) || (n == -1 && c == MinValue) {
+		*sat = true
+		if (c < 0) != (n < 0) {
+			return MinValue
+		}
+		return MaxValue
+	}
+	return p
+}
+
+// The expression matching the magnitude of a value in USD, with optional
+// grouping commas and at most two fractional digits.
+var usd = regexp.MustCompile(`^(\d{1,3}(?:,\d{3})+|\d+)(?:\.(\d{1,2}))?$`)
+
+// ParseUSD parses a string denoting a value in US dollars to a Value. The
+// dollar sign is optional, and the digits may be grouped by commas, as in
+// "$1,234.56". A negative value is written with a leading or trailing minus
+// sign, as in "-$12.50" or "$12.50-", or in parentheses, as in "($12.50)".
+// At most two fractional digits are allowed.
+func ParseUSD(s string) (Value, error) { return parseValue(strings.TrimSpace(s), s, "USD ") }
 
-// ParseUSD parses a string denoting a value in US dollars to a Value.
-func ParseUSD(s string) (Value, error) {
-	m := usd.FindStringSubmatch(s)
+// parseValue parses t, the text of s with any currency symbol other than the
+// dollar sign removed, as ParseUSD. The kind names the kind of amount in
+// errors, e.g., "USD ".
+func parseValue(t, s, kind string) (Value, error) {
+	neg := false
+	if strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")") {
+		neg, t = true, t[1:len(t)-1]
+	}
+	if !neg && strings.HasPrefix(t, "-") {
+		neg, t = true, t[1:]
+	} else if !neg && strings.HasSuffix(t, "-") {
+		neg, t = true, t[:len(t)-1]
+	}
+	t = strings.TrimPrefix(t, "$")
+	if !neg && strings.HasPrefix(t, "-") {
+		neg, t = true, t[1:] // $-12.50
+	}
+	m := usd.FindStringSubmatch(t)
 	if m == nil {
-		return 0, fmt.Errorf("invalid USD amount %q", s)
+		if frac := strings.SplitN(t, ".", 2); len(frac) == 2 && len(frac[1]) > 2 && usd.MatchString(frac[0]) {
+			return 0, fmt.Errorf("invalid %samount %q: more than two fractional digits", kind, s)
+		}
+		return 0, fmt.Errorf("invalid %samount %q", kind, s)
 	}
-	d, err := strconv.ParseInt(m[1], 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("invalid dollar amount: %v", err)
+	d, err := strconv.ParseInt(strings.ReplaceAll(m[1], ",", ""), 10, 64)
+	if err != nil || d > int64(MaxValue/Dollars)-1 {
+		return 0, fmt.Errorf("invalid %samount %q: out of range", kind, s)
 	}
 	d *= Dollars
-
-	var c, mul int64 = 0, Dollars
-	for _, ch := range m[2] {
-		c = (c * 10) + int64(ch-'0')
-		mul /= 10
+	if m[2] != "" {
+		c, _ := strconv.ParseInt((m[2] + "0")[:2], 10, 64)
+		d += c * Cents
 	}
-	d += c * mul
-	if strings.HasPrefix(m[0], "-") {
+	if neg {
 		d = -d
 	}
 	return Value(d), nil
@@ -0,0 +1,163 @@
+package currency_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/stockopt/currency"
+)
+
+func TestParseUSD(t *testing.T) {
+	tests := []struct {
+		input string
+		want  currency.Value
+	}{
+		{"$0", 0},
+		{"0.5", 50 * currency.Cents},
+		{"1234", 1234 * currency.Dollars},
+		{"$1234.56", 1234*currency.Dollars + 56*currency.Cents},
+		{"1,234.56", 1234*currency.Dollars + 56*currency.Cents},
+		{"$1,234,567", 1234567 * currency.Dollars},
+		{"  $12.5 ", 12*currency.Dollars + 50*currency.Cents},
+		{"-$12.50", -12*currency.Dollars - 50*currency.Cents},
+		{"$-12.50", -12*currency.Dollars - 50*currency.Cents},
+		{"-1.23", -1*currency.Dollars - 23*currency.Cents},
+		{"($1.23)", -1*currency.Dollars - 23*currency.Cents},
+		{"(1,000)", -1000 * currency.Dollars},
+		{"$1.23-", -1*currency.Dollars - 23*currency.Cents},
+		{"45-", -45 * currency.Dollars},
+	}
+	for _, tc := range tests {
+		got, err := currency.ParseUSD(tc.input)
+		if err != nil {
+			t.Errorf("ParseUSD(%q): unexpected error: %v", tc.input, err)
+		} else if got != tc.want {
+			t.Errorf("ParseUSD(%q): got %v, want %v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestParseUSDErrors(t *testing.T) {
+	tests := []struct {
+		input, want string // want is a substring of the error
+	}{
+		{"", "invalid USD amount"},
+		{"$", "invalid USD amount"},
+		{"1.234", "more than two fractional digits"},
+		{"$1,234.567", "more than two fractional digits"},
+		{"12x", "invalid USD amount"},
+		{"$12.5o", "invalid USD amount"},
+		{"USD 12", "invalid USD amount"},
+		{"1,23", "invalid USD amount"},
+		{"12,3456", "invalid USD amount"},
+		{"--12", "invalid USD amount"},
+		{"(-12)", "invalid USD amount"},
+		{"-$12-", "invalid USD amount"},
+		{"($12", "invalid USD amount"},
+		{"99999999999999999999", "out of range"},
+	}
+	for _, tc := range tests {
+		got, err := currency.ParseUSD(tc.input)
+		if err == nil {
+			t.Errorf("ParseUSD(%q): got %v, want error", tc.input, got)
+		} else if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ParseUSD(%q): got error %v, want %q", tc.input, err, tc.want)
+		}
+	}
+}
+
+func TestUSDRoundTrip(t *testing.T) {
+	for _, v := range []currency.Value{
+		0,
+		1 * currency.Cents,
+		-1 * currency.Cents,
+		99 * currency.Cents,
+		1234*currency.Dollars + 56*currency.Cents,
+		-1234*currency.Dollars - 5*currency.Cents,
+		92233720368546*currency.Dollars + 99*currency.Cents,
+		-92233720368546*currency.Dollars - 99*currency.Cents,
+	} {
+		s := v.USD()
+		got, err := currency.ParseUSD(s)
+		if err != nil {
+			t.Errorf("ParseUSD(%q): unexpected error: %v", s, err)
+		} else if got != v {
+			t.Errorf("ParseUSD(%q): got %v, want %v", s, got, v)
+		}
+	}
+}
+
+func TestFormatExtremes(t *testing.T) {
+	tests := []struct {
+		v    currency.Value
+		want string
+	}{
+		{currency.MaxValue, "$92233720368547.75"},
+		{currency.MinValue, "-$92233720368547.75"},
+		{currency.MinValue + 1, "-$92233720368547.75"},
+	}
+	for _, tc := range tests {
+		if got := tc.v.USD(); got != tc.want {
+			t.Errorf("USD(%v): got %q, want %q", tc.v, got, tc.want)
+		}
+	}
+	if got, want := currency.MinValue.Format("CHF"), "-92233720368547.75 CHF"; got != want {
+		t.Errorf("Format(%v, CHF): got %q, want %q", currency.MinValue, got, want)
+	}
+}
+
+func TestAddSat(t *testing.T) {
+	tests := []struct {
+		c, d, want currency.Value
+		sat        bool
+	}{
+		{1, 2, 3, false},
+		{currency.MaxValue, -1, currency.MaxValue - 1, false},
+		{currency.MaxValue, 1, currency.MaxValue, true},
+		{currency.MaxValue, currency.MaxValue, currency.MaxValue, true},
+		{currency.MinValue, -1, currency.MinValue, true},
+		{currency.MinValue, currency.MinValue, currency.MinValue, true},
+		{currency.MinValue, currency.MaxValue, -1, false},
+	}
+	for _, tc := range tests {
+		var sat bool
+		if got := tc.c.AddSat(tc.d, &sat); got != tc.want || sat != tc.sat {
+			t.Errorf("AddSat(%v, %v): got %v, %v; want %v, %v", tc.c, tc.d, got, sat, tc.want, tc.sat)
+		}
+	}
+
+	// The flag is not reset by an operation that does not saturate.
+	sat := false
+	v := currency.MaxValue.AddSat(1, &sat).AddSat(-5, &sat)
+	if !sat || v != currency.MaxValue-5 {
+		t.Errorf("AddSat series: got %v, %v; want %v, true", v, sat, currency.MaxValue-5)
+	}
+}
+
+func TestMulIntSat(t *testing.T) {
+	tests := []struct {
+		c    currency.Value
+		n    int
+		want currency.Value
+		sat  bool
+	}{
+		{3, 4, 12, false},
+		{-3, 4, -12, false},
+		{currency.MaxValue, 0, 0, false},
+		{0, -1, 0, false},
+		{currency.MaxValue, 1, currency.MaxValue, false},
+		{currency.MaxValue, 2, currency.MaxValue, true},
+		{currency.MaxValue, -2, currency.MinValue, true},
+		{currency.MinValue, -1, currency.MaxValue, true},
+		{-1, math.MinInt, currency.MaxValue, true},
+		{currency.MinValue, 1, currency.MinValue, false},
+		{currency.MaxValue / 2, 3, currency.MaxValue, true},
+	}
+	for _, tc := range tests {
+		var sat bool
+		if got := tc.c.MulIntSat(tc.n, &sat); got != tc.want || sat != tc.sat {
+			t.Errorf("MulIntSat(%v, %d): got %v, %v; want %v, %v", tc.c, tc.n, got, sat, tc.want, tc.sat)
+		}
+	}
+}
@@ -1,7 +1,3 @@
 module github.com/creachadair/stockopt
 
 go 1.23
-
-require github.com/extrame/xls v0.0.1
-
-require github.com/extrame/ole2 v0.0.0-20160812065207-d69429661ad7 // indirect
@@ -0,0 +1,224 @@
+// Package ledger records executed stock sales across runs of a planner.
+//
+// A brokerage statement may not reflect a sale until days after it is made.
+// Sales committed to a ledger can be subtracted from the lots of a statement
+// that predates them, so that shares already sold are not planned again.
+//
+// A ledger is stored as a JSON file. Amounts are written as strings in the
+// format of currency.Value.Format, so that no precision is lost to floating
+// point.
+package ledger
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/statement"
+)
+
+// A Ledger is a record of committed sales.
+type Ledger struct {
+	Sales []*Sale // in order of commitment
+}
+
+// A Sale records the shares sold on one date.
+type Sale struct {
+	Date      time.Time // the date of the sale
+	Committed time.Time // when the sale was recorded
+	Currency  string    // the currency code of the amounts of the lots
+	Lots      []Lot     // the shares sold, one per lot
+}
+
+// A Lot records the shares sold from one lot. Amounts are per share. A lot is
+// identified by its symbol, plan, acquisition date, and basis, since the lot
+// numbers of a statement change as lots are sold.
+type Lot struct {
+	Symbol   string
+	Plan     string
+	Acquired time.Time
+	Basis    currency.Value
+	Shares   int
+	Price    currency.Value
+	Gain     currency.Value
+}
+
+// Matches reports whether the lot of the statement entry e is lot.
+func (lot Lot) Matches(e *statement.Entry) bool {
+	return lot.Symbol == e.Symbol && lot.Plan == e.Plan &&
+		lot.Acquired.Equal(e.Acquired) && lot.Basis == e.IssuePrice
+}
+
+// Totals returns the total shares, proceeds, and gains of s.
+func (s *Sale) Totals() (shares int, value, gains currency.Value) {
+	for _, lot := range s.Lots {
+		n := currency.Value(lot.Shares)
+		shares += lot.Shares
+		value += n * lot.Price
+		gains += n * lot.Gain
+	}
+	return
+}
+
+// Add records a sale of the given shares on date, with amounts in the given
+// currency, committed at the current time.
+func (l *Ledger) Add(date time.Time, code string, lots []Lot) {
+	l.Sales = append(l.Sales, &Sale{Date: date, Committed: time.Now(), Currency: code, Lots: lots})
+}
+
+// Apply subtracts the shares sold by the sales of l from the matching entries
+// of es. If asOf is not zero, only sales after asOf are subtracted, since the
+// entries of a statement dated asOf already reflect earlier sales. A lot
+// matches only entries with amounts in the currency of its sale. It returns
+// the number of shares subtracted. If a sale sold more shares of a lot than
+// are available, the entry has none left.
+func (l *Ledger) Apply(es []*statement.Entry, asOf time.Time) int {
+	var total int
+	for _, s := range l.Sales {
+		if !asOf.IsZero() && !s.Date.After(asOf) {
+			continue
+		}
+		for _, lot := range s.Lots {
+			need := lot.Shares
+			for _, e := range es {
+				if need == 0 {
+					break
+				} else if !lot.Matches(e) || e.Currency != s.Currency || e.Available == 0 {
+					continue
+				}
+				n := min(need, e.Available)
+				e.Available -= n
+				need -= n
+				total += n
+			}
+		}
+	}
+	return total
+}
+
+// YearGains returns the total gains of the sales of l in each calendar year.
+// The gains of sales in different currencies are added without conversion.
+func (l *Ledger) YearGains() map[int]currency.Value {
+	out := make(map[int]currency.Value)
+	for _, s := range l.Sales {
+		_, _, gains := s.Totals()
+		out[s.Date.Year()] += gains
+	}
+	return out
+}
+
+// dateFormat is the layout of sale and acquisition dates in a ledger file.
+const dateFormat = "2006-01-02"
+
+type (
+	jsonLedger struct {
+		Sales []jsonSale `json:"sales"`
+	}
+	jsonSale struct {
+		Date      string    `json:"date"`
+		Committed time.Time `json:"committed"`
+		Currency  string    `json:"currency"`
+		Lots      []jsonLot `json:"lots"`
+	}
+	jsonLot struct {
+		Symbol   string `json:"symbol,omitempty"`
+		Plan     string `json:"plan"`
+		Acquired string `json:"acquired"`
+		Basis    string `json:"basis"`
+		Shares   int    `json:"shares"`
+		Price    string `json:"price"`
+		Gain     string `json:"gain"`
+	}
+)
+
+// Load reads the ledger stored at path. If there is no file at path, it
+// returns an empty ledger.
+func Load(path string) (*Ledger, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return new(Ledger), nil
+	} else if err != nil {
+		return nil, err
+	}
+	var jl jsonLedger
+	if err := json.Unmarshal(data, &jl); err != nil {
+		return nil, fmt.Errorf("invalid ledger %q: %v", path, err)
+	}
+	l := new(Ledger)
+	for i, js := range jl.Sales {
+		s := &Sale{Committed: js.Committed, Currency: cmp.Or(js.Currency, "USD")}
+		if s.Date, err = time.Parse(dateFormat, js.Date); err != nil {
+			return nil, fmt.Errorf("invalid ledger %q: sale %d: %v", path, i+1, err)
+		}
+		for _, jt := range js.Lots {
+			lot := Lot{Symbol: jt.Symbol, Plan: jt.Plan, Shares: jt.Shares}
+			if lot.Acquired, err = time.Parse(dateFormat, jt.Acquired); err != nil {
+				return nil, fmt.Errorf("invalid ledger %q: sale %d: %v", path, i+1, err)
+			}
+			for _, v := range []struct {
+				s string
+				p *currency.Value
+			}{{jt.Basis, &lot.Basis}, {jt.Price, &lot.Price}, {jt.Gain, &lot.Gain}} {
+				a, err := currency.ParseAmount(v.s)
+				if err != nil {
+					return nil, fmt.Errorf("invalid ledger %q: sale %d: %v", path, i+1, err)
+				}
+				*v.p = a.Value
+			}
+			s.Lots = append(s.Lots, lot)
+		}
+		l.Sales = append(l.Sales, s)
+	}
+	return l, nil
+}
+
+// Save writes l to the file at path, replacing its previous contents. The file
+// is replaced atomically, so that it is not left partly written.
+func (l *Ledger) Save(path string) error {
+	jl := jsonLedger{Sales: []jsonSale{}}
+	for _, s := range l.Sales {
+		js := jsonSale{
+			Date:      s.Date.Format(dateFormat),
+			Committed: s.Committed,
+			Currency:  s.Currency,
+			Lots:      []jsonLot{},
+		}
+		lots := append([]Lot(nil), s.Lots...)
+		sort.SliceStable(lots, func(i, j int) bool { return lots[i].Acquired.Before(lots[j].Acquired) })
+		for _, lot := range lots {
+			js.Lots = append(js.Lots, jsonLot{
+				Symbol:   lot.Symbol,
+				Plan:     lot.Plan,
+				Acquired: lot.Acquired.Format(dateFormat),
+				Basis:    lot.Basis.Format(s.Currency),
+				Shares:   lot.Shares,
+				Price:    lot.Price.Format(s.Currency),
+				Gain:     lot.Gain.Format(s.Currency),
+			})
+		}
+		jl.Sales = append(jl.Sales, js)
+	}
+	data, err := json.MarshalIndent(jl, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // does nothing once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,214 @@
+package ledger_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/ledger"
+	"github.com/creachadair/stockopt/statement"
+)
+
+func date(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+// lot returns a ledger lot of n shares sold from the GSU Class C lot of GOOG
+// acquired on the given date with the given basis, at $100 per share.
+func lot(acquired time.Time, basis currency.Value, n int) ledger.Lot {
+	price := currency.Value(100 * currency.Dollars)
+	return ledger.Lot{
+		Symbol:   "GOOG",
+		Plan:     "GSU Class C",
+		Acquired: acquired,
+		Basis:    basis,
+		Shares:   n,
+		Price:    price,
+		Gain:     price - basis,
+	}
+}
+
+// entry returns a USD statement entry for n available shares of the lot sold
+// by lot(acquired, basis, ...).
+func entry(acquired time.Time, basis currency.Value, n int) *statement.Entry {
+	return &statement.Entry{
+		Symbol:     "GOOG",
+		Currency:   "USD",
+		Plan:       "GSU Class C",
+		Acquired:   acquired,
+		IssuePrice: basis,
+		Available:  n,
+		Price:      100 * currency.Dollars,
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.json")
+
+	// A ledger that does not exist is empty.
+	l, err := ledger.Load(path)
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	} else if len(l.Sales) != 0 {
+		t.Fatalf("Load: got %d sales, want 0", len(l.Sales))
+	}
+
+	committed := time.Date(2025, 3, 2, 15, 4, 5, 0, time.UTC)
+	want := &ledger.Ledger{Sales: []*ledger.Sale{{
+		Date:      date(2025, 3, 1),
+		Committed: committed,
+		Currency:  "USD",
+		Lots: []ledger.Lot{
+			lot(date(2020, 1, 15), 70*currency.Dollars+5*currency.Cents, 10),
+			lot(date(2024, 6, 15), 160*currency.Dollars, 3),
+		},
+	}, {
+		Date:      date(2025, 4, 1),
+		Committed: committed.AddDate(0, 1, 0),
+		Currency:  "EUR",
+		Lots:      []ledger.Lot{lot(date(2021, 2, 1), 90*currency.Dollars, 1)},
+	}}}
+	if err := want.Save(path); err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+	got, err := ledger.Load(path)
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load: got %+v, want %+v", got, want)
+		for i, s := range got.Sales {
+			t.Logf("Sale %d: %+v", i+1, *s)
+		}
+	}
+
+	// Saving replaces the file, and leaves no temporary files behind.
+	want.Sales = want.Sales[:1]
+	if err := want.Save(path); err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+	if got, err := ledger.Load(path); err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	} else if len(got.Sales) != 1 {
+		t.Errorf("Load: got %d sales, want 1", len(got.Sales))
+	}
+	if files, err := os.ReadDir(filepath.Dir(path)); err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	} else if len(files) != 1 {
+		t.Errorf("ReadDir: got %d files, want only the ledger", len(files))
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for _, data := range []string{
+		`not JSON`,
+		`{"sales": [{"date": "03/01/2025", "lots": []}]}`,
+		`{"sales": [{"date": "2025-03-01", "lots": [{"acquired": "2020-01-15", "basis": "ten dollars"}]}]}`,
+	} {
+		path := filepath.Join(dir, "ledger.json")
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if l, err := ledger.Load(path); err == nil {
+			t.Errorf("Load(%q): got %+v, want error", data, l)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	jan, jun := date(2020, 1, 15), date(2024, 6, 15)
+	basis := currency.Value(70 * currency.Dollars)
+	l := &ledger.Ledger{Sales: []*ledger.Sale{{
+		Date:     date(2025, 3, 1),
+		Currency: "USD",
+		Lots:     []ledger.Lot{lot(jan, basis, 4)},
+	}, {
+		Date:     date(2025, 3, 10),
+		Currency: "USD",
+		Lots:     []ledger.Lot{lot(jun, basis, 20)},
+	}, {
+		Date:     date(2025, 3, 20),
+		Currency: "EUR",
+		Lots:     []ledger.Lot{lot(jan, basis, 1)},
+	}}}
+
+	tests := []struct {
+		name  string
+		es    []*statement.Entry
+		asOf  time.Time
+		want  []int // available shares of es after
+		total int
+	}{
+		{"Partial", []*statement.Entry{entry(jan, basis, 10)}, time.Time{}, []int{6}, 4},
+
+		// Only the lot with the same acquisition date and basis is sold.
+		{"OtherLots", []*statement.Entry{
+			entry(jan, basis+1, 10), entry(jan.AddDate(0, 0, 1), basis, 10), entry(jan, basis, 10),
+		}, time.Time{}, []int{10, 10, 6}, 4},
+
+		// The sale is split over the entries of the lot, in order.
+		{"Split", []*statement.Entry{entry(jan, basis, 3), entry(jan, basis, 3)}, time.Time{}, []int{0, 2}, 4},
+
+		// More shares sold than are available clamp the entry at zero.
+		{"Clamped", []*statement.Entry{entry(jun, basis, 8)}, time.Time{}, []int{0}, 8},
+
+		// The statement already reflects the sales on or before its date.
+		{"AsOfSale", []*statement.Entry{entry(jan, basis, 10), entry(jun, basis, 30)}, date(2025, 3, 1), []int{10, 10}, 20},
+		{"AsOfLater", []*statement.Entry{entry(jun, basis, 30)}, date(2025, 3, 10), []int{30}, 0},
+		{"AsOfEarlier", []*statement.Entry{entry(jan, basis, 10)}, date(2025, 2, 28), []int{6}, 4},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			total := l.Apply(tc.es, tc.asOf)
+			var got []int
+			for _, e := range tc.es {
+				got = append(got, e.Available)
+			}
+			if total != tc.total || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Apply: got %d shares, available %v; want %d, %v", total, got, tc.total, tc.want)
+			}
+		})
+	}
+
+	t.Run("Mismatch", func(t *testing.T) {
+		// A lot does not match an entry of another currency, plan, or symbol.
+		eur := entry(jan, basis, 10)
+		eur.Currency = "EUR"
+		plan := entry(jan, basis, 10)
+		plan.Plan = "GSU Class A"
+		sym := entry(jan, basis, 10)
+		sym.Symbol = "GOOGL"
+		es := []*statement.Entry{eur, plan, sym}
+		if total := l.Apply(es, time.Time{}); total != 1 {
+			t.Errorf("Apply: got %d shares, want 1", total)
+		}
+		for i, want := range []int{9, 10, 10} {
+			if es[i].Available != want {
+				t.Errorf("Apply: entry %d has %d shares, want %d", i+1, es[i].Available, want)
+			}
+		}
+	})
+}
+
+func TestYearGains(t *testing.T) {
+	sell := func(y int, lots ...ledger.Lot) *ledger.Sale {
+		return &ledger.Sale{Date: date(y, 6, 1), Currency: "USD", Lots: lots}
+	}
+	l := &ledger.Ledger{Sales: []*ledger.Sale{
+		sell(2024, lot(date(2020, 1, 1), 70*currency.Dollars, 10)),                                                // gain $300
+		sell(2025, lot(date(2021, 1, 1), 40*currency.Dollars, 2), lot(date(2022, 1, 1), 150*currency.Dollars, 3)), // $120 - $150
+		sell(2025, lot(date(2023, 1, 1), 99*currency.Dollars, 1)),                                                 // $1
+	}}
+
+	shares, value, gains := l.Sales[1].Totals()
+	if shares != 5 || value != 500*currency.Dollars || gains != -30*currency.Dollars {
+		t.Errorf("Totals: got %d, %v, %v; want 5, $500, -$30", shares, value, gains)
+	}
+
+	want := map[int]currency.Value{2024: 300 * currency.Dollars, 2025: -29 * currency.Dollars}
+	if got := l.YearGains(); !reflect.DeepEqual(got, want) {
+		t.Errorf("YearGains: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,527 @@
+package stockopt
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/report"
+	"github.com/creachadair/stockopt/solver"
+	"github.com/creachadair/stockopt/statement"
+)
+
+// An Objective selects what a plan optimizes.
+type Objective string
+
+// The supported objectives.
+const (
+	// MaxValue maximizes the value sold without exceeding the gains cap.
+	MaxValue Objective = "max-value"
+
+	// ValueThenCompact is MaxValue, breaking ties by preferring the plan that
+	// sells fewer shares, and then fewer lots.
+	ValueThenCompact Objective = "value-then-compact"
+
+	// MinGain raises at least the target proceeds while realizing the smallest
+	// possible gain.
+	MinGain Objective = "min-gain"
+
+	// Harvest realizes at least the target capital loss, selling only lots
+	// with a loss.
+	Harvest Objective = "harvest"
+)
+
+// Constraints describe which lots of a portfolio are eligible for sale, and
+// the limits and objective of a plan to sell them.
+type Constraints struct {
+	// The date of the sale. If zero, the current time is used.
+	SaleDate time.Time
+
+	// The objective of the plan. If empty, MinGain is used if Proceeds is
+	// positive, Harvest if Loss is positive, and otherwise MaxValue.
+	Objective Objective
+
+	// The cap on the total gain realized, with MaxValue and ValueThenCompact.
+	GainsCap currency.Value
+
+	// The target proceeds, with MinGain.
+	Proceeds currency.Value
+
+	// If positive, the maximum ratio of realized gain to proceeds, with
+	// MinGain.
+	MaxGainRatio float64
+
+	// The target capital loss, with Harvest.
+	Loss currency.Value
+
+	// Additional caps on the total gain of subsets of the lots, with MaxValue
+	// and ValueThenCompact. The IDs of the entries passed to the Applies
+	// functions are of type *statement.Entry.
+	Limits []solver.Limit
+
+	// If not nil, reports whether a lot is old enough to be sold on the given
+	// date. If nil, a lot is old enough once its sale would be long-term.
+	MinAge func(e *statement.Entry, date time.Time) bool
+
+	// If not empty, only lots issued under this plan are eligible. If
+	// PlanFormats is not empty, the plan applies only to the lots of
+	// statements in those formats.
+	Plan        string
+	PlanFormats []statement.Format
+
+	// Minimum holding periods imposed by plans, by plan name. A lot is not
+	// eligible until it has been held for the period of its plan.
+	HoldPeriods map[string]statement.Period
+
+	// If true, lots whose sale would realize a capital loss are eligible.
+	// Harvest implies AllowLoss.
+	AllowLoss bool
+
+	// If positive, the maximum fraction of each lot to sell.
+	MaxLotFraction float64
+
+	// If positive, the market value per share, overriding the values stated
+	// in the statements.
+	MarketPrice currency.Value
+
+	// Sale values per share overriding those of the statements and the
+	// market price, keyed by the numbers of the eligible lots.
+	Values map[int]currency.Value
+
+	// The tax rate (percent) on realized gains.
+	TaxRate float64
+
+	// If true, short-term gains are taxed at ShortTaxRate (percent) and the
+	// plan maximizes the value net of the tax on each lot; TaxRate then
+	// applies to long-term gains.
+	TaxShortTerm bool
+	ShortTaxRate float64
+
+	// If true, search for a provably optimal plan with MaxValue,
+	// ValueThenCompact, and MinGain however long the search takes. Otherwise
+	// the search for MaxValue and ValueThenCompact stops after a fixed number
+	// of steps, and the search for MinGain is used only for at most
+	// solver.ExactLimit lots.
+	Exact bool
+
+	// If positive, plan sales over this many years, one sale each year on the
+	// anniversary of SaleDate, with a cap of AnnualCap on the gain of each
+	// year. Only MaxValue and ValueThenCompact support multi-year plans.
+	Years     int
+	AnnualCap currency.Value
+}
+
+func (c *Constraints) objective() Objective {
+	switch {
+	case c.Objective != "":
+		return c.Objective
+	case c.Proceeds > 0:
+		return MinGain
+	case c.Loss > 0:
+		return Harvest
+	}
+	return MaxValue
+}
+
+func (c *Constraints) oldEnough(e *statement.Entry, date time.Time) bool {
+	if c.MinAge == nil {
+		return e.IsLongTerm(date)
+	}
+	return c.MinAge(e, date)
+}
+
+func (c *Constraints) held(e *statement.Entry, date time.Time) bool {
+	p, ok := c.HoldPeriods[e.Plan]
+	return ok && date.Before(p.AddTo(e.Acquired))
+}
+
+func (c *Constraints) planMatches(s *Statement, e *statement.Entry) bool {
+	if c.Plan == "" || e.Plan == c.Plan {
+		return true
+	} else if len(c.PlanFormats) == 0 {
+		return false
+	}
+	for _, f := range c.PlanFormats {
+		if s.Format == f {
+			return false
+		}
+	}
+	return true
+}
+
+// LotCeiling returns the maximum number of shares of e that may be sold.
+func (c *Constraints) LotCeiling(e *statement.Entry) int {
+	if c.MaxLotFraction > 0 {
+		return int(math.Floor(c.MaxLotFraction * float64(e.Available)))
+	}
+	return e.Available
+}
+
+// LotTaxRate returns the tax rate (percent) on the gain of e if sold on
+// saleDate.
+func (c *Constraints) LotTaxRate(e *statement.Entry, saleDate time.Time) float64 {
+	if c.TaxShortTerm && !e.IsLongTerm(saleDate) {
+		return c.ShortTaxRate
+	}
+	return c.TaxRate
+}
+
+// Tax returns the estimated tax on the gains of soln. If TaxShortTerm is set,
+// the tax on each entry's gain is computed at the rate for its term.
+func (c *Constraints) Tax(soln []solver.Entry) currency.Value {
+	if !c.TaxShortTerm {
+		return Summarize(soln).Gains.Percent(c.TaxRate)
+	}
+	var long, short currency.Value
+	for _, elt := range soln {
+		if elt.LongTerm {
+			long += elt.Gain * currency.Value(elt.N)
+		} else {
+			short += elt.Gain * currency.Value(elt.N)
+		}
+	}
+	return long.Percent(c.TaxRate) + short.Percent(c.ShortTaxRate)
+}
+
+// Entries converts the lots in es to solver entries for a sale on saleDate.
+// The ID of each entry is its lot.
+func (c *Constraints) Entries(es []*statement.Entry, saleDate time.Time) []solver.Entry {
+	out := make([]solver.Entry, len(es))
+	for i, e := range es {
+		out[i] = solver.Entry{
+			ID:       e,
+			N:        c.LotCeiling(e),
+			Value:    e.Price,
+			Gain:     e.Gain,
+			LongTerm: e.IsLongTerm(saleDate),
+			TaxRate:  c.LotTaxRate(e, saleDate),
+		}
+	}
+	return out
+}
+
+// A Plan is a plan to sell lots of a portfolio.
+type Plan struct {
+	// The constraints of the plan, with defaults applied.
+	Constraints Constraints
+
+	// The lots eligible for sale, in order of acquisition and numbered from 1.
+	// These are copies of the lots of the portfolio, with the market price
+	// and value overrides applied.
+	Lots []*statement.Entry
+
+	// The lots excluded only by the holding periods of their plans.
+	Held []*statement.Entry
+
+	// The solver input: the eligible lots, less any excluded to avoid wash
+	// sales, with at most the lot ceiling of each lot.
+	Input []solver.Entry
+
+	// The lots of the portfolio with available shares acquired within the
+	// wash-sale window of the sale date, any of which could make a sale at a
+	// loss a wash sale. Eligible lots are represented by their copies in Lots.
+	Replacements []*statement.Entry
+
+	// Warnings about the inputs, such as lots excluded from the plan.
+	Warnings []string
+
+	// The sale dates of the plan: one for each year of a multi-year plan, and
+	// otherwise only the sale date.
+	Dates []time.Time
+
+	// After Solve, the lots sold and the limits that bound the plan. For a
+	// multi-year plan, Result is nil and Schedule has the lots sold in each
+	// year.
+	Result   *solver.Result
+	Schedule [][]solver.Entry
+
+	solver *solver.Solver
+}
+
+// SaleDate returns the date of the (first) sale of p.
+func (p *Plan) SaleDate() time.Time { return p.Dates[0] }
+
+// Build returns a plan to sell the lots of portfolio subject to the given
+// constraints. It is equivalent to Select followed by Solve.
+func Build(portfolio *Portfolio, c *Constraints) (*Plan, error) {
+	p := Select(portfolio, c)
+	if err := p.Solve(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Select returns an unsolved plan for the lots of portfolio eligible for sale
+// under the given constraints.
+//
+// A lot is eligible if it has available shares, it is old enough to be sold by
+// the last sale date of the plan, its plan matches, it has a gain or
+// AllowLoss is set, and its plan holding period has elapsed. With Harvest, a
+// lot with a loss is not eligible if its sale would be a wash sale.
+func Select(portfolio *Portfolio, c *Constraints) *Plan {
+	p := &Plan{Constraints: *c}
+	c = &p.Constraints
+	if c.SaleDate.IsZero() {
+		c.SaleDate = time.Now()
+	}
+	c.Objective = c.objective()
+	if c.Objective == Harvest {
+		c.AllowLoss = true // harvesting sells only lots with a loss
+	}
+	p.Dates = []time.Time{c.SaleDate}
+	for y := 1; y < c.Years; y++ {
+		p.Dates = append(p.Dates, c.SaleDate.AddDate(y, 0, 0))
+	}
+	lastSale := p.Dates[len(p.Dates)-1]
+
+	// Eligibility is decided by the values stated in the statements, before
+	// the market price applies.
+	copies := make(map[*statement.Entry]*statement.Entry)
+	for _, s := range portfolio.Statements {
+		for _, e := range s.Lots {
+			if !(e.Available > 0 && c.oldEnough(e, lastSale) && c.planMatches(s, e) &&
+				(e.Gain >= 0 || c.AllowLoss)) {
+				continue
+			} else if c.held(e, lastSale) {
+				p.Held = append(p.Held, e)
+				continue
+			}
+			cp := *e
+			if c.MarketPrice > 0 {
+				cp.Price = c.MarketPrice
+				cp.Gain = c.MarketPrice - cp.IssuePrice
+			}
+			copies[e] = &cp
+			p.Lots = append(p.Lots, &cp)
+		}
+	}
+	sort.SliceStable(p.Lots, func(i, j int) bool { return p.Lots[i].Acquired.Before(p.Lots[j].Acquired) })
+	for i, e := range p.Lots {
+		e.Index = i + 1
+	}
+	for _, s := range portfolio.Statements {
+		for _, e := range s.Lots {
+			if e.Available > 0 && InWashWindow(e.Acquired, c.SaleDate) {
+				p.Replacements = append(p.Replacements, cmp.Or(copies[e], e))
+			}
+		}
+	}
+	p.applyValues()
+
+	es := p.Lots
+	if c.Objective == Harvest {
+		// Selling a lot at a loss within the wash-sale window of another
+		// acquisition would disallow the loss, so exclude such lots.
+		es = make([]*statement.Entry, 0, len(p.Lots))
+		for _, e := range p.Lots {
+			if r := WashReplacement(e, p.Replacements, c.SaleDate); r != nil && e.Gain < 0 {
+				p.warnf("lot %d excluded: a sale at a loss would be a wash sale with the shares acquired %s",
+					e.Index, r.Acquired.Format(statement.DateFormat))
+				continue
+			}
+			es = append(es, e)
+		}
+	}
+	p.Input = c.Entries(es, c.SaleDate)
+	return p
+}
+
+// applyValues updates the price and gain of the eligible lots overridden by
+// the Values of the constraints.
+func (p *Plan) applyValues() {
+	byIndex := make(map[int]*statement.Entry)
+	var code string // the currency of the values, for warnings
+	for _, e := range p.Lots {
+		byIndex[e.Index] = e
+		code = cmp.Or(code, e.Currency)
+	}
+	lots := make([]int, 0, len(p.Constraints.Values))
+	for lot := range p.Constraints.Values {
+		lots = append(lots, lot)
+	}
+	sort.Ints(lots)
+	for _, lot := range lots {
+		v := p.Constraints.Values[lot]
+		e, ok := byIndex[lot]
+		if !ok {
+			p.warnf("no lot %d for value override %s", lot, v.Format(code))
+			continue
+		}
+		e.Price = v
+		e.Gain = v - e.IssuePrice
+	}
+}
+
+func (p *Plan) warnf(msg string, args ...interface{}) {
+	p.Warnings = append(p.Warnings, fmt.Sprintf(msg, args...))
+}
+
+func (p *Plan) options() *solver.Options {
+	c := &p.Constraints
+	return &solver.Options{
+		Compact:       c.Objective == ValueThenCompact,
+		MaxGainRatio:  c.MaxGainRatio,
+		Limits:        c.Limits,
+		ExcludeLosses: !c.AllowLoss,
+		AfterTax:      c.TaxShortTerm,
+		Exact:         c.Exact,
+	}
+}
+
+// ErrGainRatio is reported by Solve if no plan found raises the target
+// proceeds within the maximum gain ratio.
+var ErrGainRatio = errors.New("no plan is within the maximum gain ratio")
+
+// Solve chooses the lots of p to sell. If the target of the objective cannot
+// be met, the plan sells all the eligible lots (with a loss, for Harvest).
+func (p *Plan) Solve() error {
+	c := &p.Constraints
+	switch c.Objective {
+	case MaxValue, ValueThenCompact:
+	case MinGain:
+		if c.Proceeds <= 0 {
+			return errors.New("the min-gain objective requires positive target proceeds")
+		}
+	case Harvest:
+		if c.Loss <= 0 {
+			return errors.New("the harvest objective requires a positive target loss")
+		}
+	default:
+		return fmt.Errorf("unknown objective %q", c.Objective)
+	}
+	if c.Years > 0 {
+		if c.Objective != MaxValue && c.Objective != ValueThenCompact {
+			return fmt.Errorf("the %s objective does not support multi-year plans", c.Objective)
+		}
+		budgets := make([]solver.YearBudget, len(p.Dates))
+		for y, date := range p.Dates {
+			date := date
+			budgets[y] = solver.YearBudget{
+				Cap: c.AnnualCap,
+				Eligible: func(elt solver.Entry) bool {
+					e := elt.ID.(*statement.Entry)
+					return !c.held(e, date) && c.oldEnough(e, date)
+				},
+			}
+		}
+		p.Schedule = solver.PlanYears(p.Input, budgets, p.options())
+		return nil
+	}
+
+	p.solver = solver.New(p.Input, p.options())
+	switch c.Objective {
+	case Harvest:
+		p.Result = p.solver.Analyze(p.solver.SolveForLoss(c.Loss), currency.MaxValue)
+	case MinGain:
+		soln := p.solver.SolveForProceeds(c.Proceeds)
+		if soln == nil {
+			return ErrGainRatio
+		}
+		p.Result = p.solver.Analyze(soln, currency.MaxValue)
+	default:
+		soln, diag := p.solver.Solve(c.GainsCap)
+		p.Result = p.solver.Analyze(soln, c.GainsCap)
+		p.Result.Diagnostics = &diag
+	}
+	return nil
+}
+
+// FIFO returns the first-in, first-out sale of the lots of p within the gains
+// cap, for comparison with the plan. It must not be called before Solve, or
+// for a multi-year plan.
+func (p *Plan) FIFO() []solver.Entry { return p.solver.SolveInOrder(p.Constraints.GainsCap) }
+
+// Report converts the sale plan in p, with the given params, to a report.
+// Lots "sold out" at a per-lot ceiling are reported as bound by "lot-cap"
+// rather than "sold-out".
+func (p *Plan) Report(params report.Params) *report.Plan {
+	c := &p.Constraints
+	rp := &report.Plan{Params: params}
+	for _, elt := range p.Result.Entries {
+		e := elt.ID.(*statement.Entry)
+		rp.Lots = append(rp.Lots, report.Lot{
+			Index:    e.Index,
+			Acquired: e.Acquired,
+			LongTerm: e.LongTerm,
+			Long:     elt.LongTerm,
+			Shares:   elt.N,
+			Price:    elt.Value,
+			Basis:    e.IssuePrice,
+			Gain:     elt.Gain,
+		})
+	}
+	for _, b := range p.Result.Bindings {
+		rb := report.Binding{Constraint: b.Constraint}
+		var capped []int // lots "sold out" at a per-lot ceiling
+		for _, id := range b.IDs {
+			e := id.(*statement.Entry)
+			if b.Constraint == solver.SoldOut && c.LotCeiling(e) < e.Available {
+				capped = append(capped, e.Index)
+			} else {
+				rb.Lots = append(rb.Lots, e.Index)
+			}
+		}
+		if len(rb.Lots) != 0 {
+			rp.Bindings = append(rp.Bindings, rb)
+		}
+		if len(capped) != 0 {
+			rp.Bindings = append(rp.Bindings, report.Binding{Constraint: "lot-cap", Lots: capped})
+		}
+	}
+	sum := Summarize(p.Result.Entries)
+	rp.Totals = report.Totals{
+		Shares: sum.Shares,
+		Value:  sum.Value,
+		Gains:  sum.Gains,
+		Basis:  sum.Basis,
+		Tax:    c.Tax(p.Result.Entries),
+	}
+	if d := p.Result.Diagnostics; d != nil {
+		rp.Solver = &report.Solver{
+			Optimal:   d.Optimal,
+			Aborted:   d.Aborted,
+			Objective: d.Objective,
+			Bound:     d.Bound,
+		}
+	}
+	return rp
+}
+
+// A Summary records the aggregate totals of a sale plan.
+type Summary struct {
+	Shares int
+	Value  currency.Value
+	Gains  currency.Value
+	Basis  currency.Value
+}
+
+// GainPercent returns the gains of s as a percentage of its cost basis. It
+// reports false if the cost basis is zero.
+func (s Summary) GainPercent() (float64, bool) {
+	if s.Basis == 0 {
+		return 0, false
+	}
+	return 100 * float64(s.Gains) / float64(s.Basis), true
+}
+
+// Summarize computes the totals of the sale plan in soln, whose IDs must be of
+// type *statement.Entry.
+//
+// N.B.: We sum the cost bases per lot instead of taking the ending bounds,
+// so that rounding does not occur per transaction.
+func Summarize(soln []solver.Entry) Summary {
+	var sum Summary
+	for _, elt := range soln {
+		e := elt.ID.(*statement.Entry)
+		sum.Shares += elt.N
+		vn := currency.Value(elt.N)
+		sum.Basis += vn * e.IssuePrice
+		sum.Value += vn * elt.Value
+		sum.Gains += vn * elt.Gain
+	}
+	return sum
+}
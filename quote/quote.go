@@ -0,0 +1,123 @@
+// Package quote fetches current market prices for securities.
+package quote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/creachadair/stockopt/currency"
+)
+
+// A Provider fetches the current price per share of a security.
+type Provider interface {
+	Quote(ctx context.Context, symbol string) (currency.Value, error)
+}
+
+// DefaultURL is the default URL template for an HTTP provider, and
+// DefaultField the location of the price in its response.
+const (
+	DefaultURL   = "https://query1.finance.yahoo.com/v8/finance/chart/{symbol}"
+	DefaultField = "chart.result.0.meta.regularMarketPrice"
+)
+
+// HTTP is a Provider that fetches a quote with an HTTP GET request.
+type HTTP struct {
+	// The URL template of the request. The string "{symbol}" is replaced by
+	// the symbol of the security, escaped for use in a URL path.
+	URL string
+
+	// The location of the price in the JSON response, as a dot-separated path
+	// of object keys and array indexes, e.g., "quote.0.price". If empty, the
+	// response body is the price as plain text.
+	Field string
+
+	// The client used to send requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+func (h *HTTP) client() *http.Client {
+	if h.Client == nil {
+		return http.DefaultClient
+	}
+	return h.Client
+}
+
+// Quote implements the Provider interface.
+func (h *HTTP) Quote(ctx context.Context, symbol string) (currency.Value, error) {
+	if symbol == "" {
+		return 0, errors.New("empty symbol")
+	}
+	u := strings.ReplaceAll(h.URL, "{symbol}", url.PathEscape(symbol))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	rsp, err := h.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(rsp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	} else if rsp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("quote request failed: %s", rsp.Status)
+	}
+
+	var price float64
+	if h.Field == "" {
+		price, err = strconv.ParseFloat(strings.TrimSpace(string(body)), 64)
+	} else {
+		price, err = jsonNumber(body, h.Field)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid quote: %v", err)
+	} else if math.IsNaN(price) || math.IsInf(price, 0) {
+		return 0, fmt.Errorf("invalid quote: price %v is not finite", price)
+	} else if price <= 0 {
+		return 0, fmt.Errorf("invalid quote: price %v is not positive", price)
+	}
+	// Round to the nearest cent, the precision of a quoted price.
+	cents := math.Round(price * 100)
+	if cents < 1 {
+		return 0, fmt.Errorf("invalid quote: price %v is less than a cent", price)
+	} else if cents >= float64(currency.MaxValue/currency.Cents) {
+		return 0, fmt.Errorf("invalid quote: price %v is out of range", price)
+	}
+	return currency.Value(cents) * currency.Cents, nil
+}
+
+// jsonNumber returns the number at the given path in the JSON data.
+func jsonNumber(data []byte, path string) (float64, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return 0, err
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return 0, fmt.Errorf("no element %q in %q", key, path)
+			}
+			v = t[i]
+		default:
+			return 0, fmt.Errorf("no field %q in %q", key, path)
+		}
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("field %q is not a number", path)
+	}
+	return f, nil
+}
@@ -0,0 +1,112 @@
+package quote_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/quote"
+)
+
+// server returns a test server that responds to every request with the given
+// status and body, and records the path of the last request in *path.
+func server(t *testing.T, status int, body string, path *string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path != nil {
+			*path = r.URL.EscapedPath()
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestQuote(t *testing.T) {
+	const chart = `{"chart": {"result": [{"meta": {"symbol": "GOOG", "regularMarketPrice": 1234.565}}]}}`
+	tests := []struct {
+		name, field, body string
+		want              currency.Value
+	}{
+		{"Text", "", "1500.25\n", 1500*currency.Dollars + 25*currency.Cents},
+		{"TextRounded", "", " 99.996 ", 100 * currency.Dollars},
+		{"JSON", quote.DefaultField, chart, 1234*currency.Dollars + 57*currency.Cents},
+		{"JSONIndex", "quote.1.price", `{"quote": [{"price": 1}, {"price": 42.5}]}`, 42*currency.Dollars + 50*currency.Cents},
+		{"Cent", "", "0.01", 1 * currency.Cents},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var path string
+			srv := server(t, http.StatusOK, tc.body, &path)
+			p := &quote.HTTP{URL: srv.URL + "/quote/{symbol}", Field: tc.field}
+			got, err := p.Quote(context.Background(), "BRK B")
+			if err != nil {
+				t.Fatalf("Quote: unexpected error: %v", err)
+			} else if got != tc.want {
+				t.Errorf("Quote: got %v, want %v", got, tc.want)
+			}
+			if want := "/quote/BRK%20B"; path != want {
+				t.Errorf("Quote: requested %q, want %q", path, want)
+			}
+		})
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		field  string
+		body   string
+		want   string // a substring of the error
+	}{
+		{"NotFound", http.StatusNotFound, "", "1500", "404"},
+		{"Unavailable", http.StatusServiceUnavailable, "", "", "503"},
+		{"Empty", http.StatusOK, "", "", "invalid quote"},
+		{"NotANumber", http.StatusOK, "", "$1500", "invalid quote"},
+		{"MalformedJSON", http.StatusOK, "price", `{"price": 15`, "invalid quote"},
+		{"EmptyJSON", http.StatusOK, "price", ``, "invalid quote"},
+		{"MissingField", http.StatusOK, "quote.price", `{"quote": {}}`, "not a number"},
+		{"MissingIndex", http.StatusOK, "quote.2.price", `{"quote": [{"price": 1}]}`, "no element"},
+		{"NotAnObject", http.StatusOK, "quote.price", `{"quote": 5}`, "no field"},
+		{"StringPrice", http.StatusOK, "price", `{"price": "1500"}`, "not a number"},
+		{"Zero", http.StatusOK, "", "0", "not positive"},
+		{"Negative", http.StatusOK, "price", `{"price": -3.5}`, "not positive"},
+		{"LessThanCent", http.StatusOK, "", "0.004", "less than a cent"},
+		{"NaN", http.StatusOK, "", "NaN", "not finite"},
+		{"Inf", http.StatusOK, "", "+Inf", "not finite"},
+		{"TooLarge", http.StatusOK, "", "1e300", "out of range"},
+		{"JustTooLarge", http.StatusOK, "", "92233720368547.76", "out of range"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := server(t, tc.status, tc.body, nil)
+			p := &quote.HTTP{URL: srv.URL + "/{symbol}", Field: tc.field}
+			got, err := p.Quote(context.Background(), "GOOG")
+			if err == nil {
+				t.Fatalf("Quote: got %v, want error", got)
+			} else if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Quote: got error %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	t.Run("EmptySymbol", func(t *testing.T) {
+		p := &quote.HTTP{URL: "http://invalid.test/{symbol}"}
+		if got, err := p.Quote(context.Background(), ""); err == nil {
+			t.Errorf("Quote: got %v, want error", got)
+		}
+	})
+	t.Run("Unreachable", func(t *testing.T) {
+		srv := server(t, http.StatusOK, "1", nil)
+		srv.Close()
+		p := &quote.HTTP{URL: srv.URL + "/{symbol}"}
+		if got, err := p.Quote(context.Background(), "GOOG"); err == nil {
+			t.Errorf("Quote: got %v, want error", got)
+		}
+	})
+}
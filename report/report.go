@@ -0,0 +1,247 @@
+// Package report renders stock sale plans in machine-readable formats.
+//
+// Amounts are written as strings in the format of currency.Value.Format, so
+// that no precision is lost to floating point.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/statement"
+)
+
+// A Plan describes a sale plan to be reported.
+type Plan struct {
+	Params   Params
+	Lots     []Lot     // the shares sold, one per lot
+	Bindings []Binding // the constraints at their limit, if any
+	Totals   Totals
+	Solver   *Solver // how the plan was found, if known
+}
+
+// Params records the input parameters of a sale plan. Exactly one of the
+// gains cap, the raise target, and the harvest target is set. Summary is true
+// if the plan lists the available shares rather than shares to sell. Currency
+// is the code of the currency of all amounts (default USD).
+type Params struct {
+	Summary       bool    `json:"summary,omitempty"`
+	SaleDate      string  `json:"sale_date"`
+	MinAge        string  `json:"min_age"`
+	GainsCap      string  `json:"gains_cap,omitempty"`
+	RaiseTarget   string  `json:"raise_target,omitempty"`
+	HarvestTarget string  `json:"harvest_target,omitempty"`
+	TaxRate       float64 `json:"tax_rate"`
+	ShortRate     float64 `json:"short_term_tax_rate,omitempty"`
+	MarketPrice   string  `json:"market_price,omitempty"`
+	Currency      string  `json:"currency,omitempty"`
+}
+
+// A Lot records the shares sold from one lot. Amounts are per share.
+type Lot struct {
+	Index    int       // the lot number in the statement
+	Acquired time.Time // when the shares were acquired
+	LongTerm time.Time // the first date on which a sale is long-term
+	Long     bool      // whether the sale is long-term
+	Shares   int       // the number of shares sold
+	Price    currency.Value
+	Basis    currency.Value
+	Gain     currency.Value
+}
+
+// A Binding records a constraint at its limit, with the numbers of the lots
+// the constraint applies to.
+type Binding struct {
+	Constraint string
+	Lots       []int
+}
+
+// Totals records the aggregate totals of a sale plan.
+type Totals struct {
+	Shares int
+	Value  currency.Value
+	Gains  currency.Value
+	Basis  currency.Value
+	Tax    currency.Value // the estimated tax on the gains
+}
+
+// Solver records how the solver found a sale plan. The objective is the total
+// value of the plan, or its value net of tax if the plan maximizes that, and
+// the bound is an upper bound on the objective of an optimal plan.
+type Solver struct {
+	Optimal   bool // whether the plan is known to be optimal
+	Aborted   bool // whether the search stopped before it finished
+	Objective currency.Value
+	Bound     currency.Value
+}
+
+// term returns the term of the sale of the lot, "LT" (long-term) or "ST"
+// (short-term), as labelled in the text output.
+func (lot Lot) term() string {
+	if lot.Long {
+		return "LT"
+	}
+	return "ST"
+}
+
+// WriteJSON writes p to w as a JSON object with the parameters of the plan,
+// an array of lots, an array of bindings, the totals, and how the solver found
+// the plan, if known. The arrays are empty rather than null if p has no lots
+// or bindings.
+func WriteJSON(w io.Writer, p *Plan) error {
+	code := p.Params.Currency
+	type jsonLot struct {
+		Lot      int    `json:"lot"`
+		Acquired string `json:"acquired"`
+		LongTerm string `json:"long_term_date"`
+		Term     string `json:"term"`
+		Shares   int    `json:"shares"`
+		Value    string `json:"value"`
+		Basis    string `json:"basis"`
+		Gain     string `json:"gain"`
+	}
+	type jsonBinding struct {
+		Constraint string `json:"constraint"`
+		Lots       []int  `json:"lots"`
+	}
+	type jsonTotals struct {
+		Shares      int      `json:"shares"`
+		Value       string   `json:"value"`
+		Gains       string   `json:"gains"`
+		Basis       string   `json:"basis"`
+		Tax         string   `json:"tax"`
+		GainPercent *float64 `json:"gain_percent_of_basis,omitempty"`
+	}
+	type jsonSolver struct {
+		Optimal   bool   `json:"optimal"`
+		Aborted   bool   `json:"aborted"`
+		Objective string `json:"objective"`
+		Bound     string `json:"bound"`
+		Gap       string `json:"gap"`
+	}
+	out := struct {
+		Params   Params        `json:"params"`
+		Lots     []jsonLot     `json:"lots"`
+		Bindings []jsonBinding `json:"bindings"`
+		Totals   jsonTotals    `json:"totals"`
+		Solver   *jsonSolver   `json:"solver,omitempty"`
+	}{
+		Params:   p.Params,
+		Lots:     []jsonLot{},
+		Bindings: []jsonBinding{},
+		Totals: jsonTotals{
+			Shares: p.Totals.Shares,
+			Value:  p.Totals.Value.Format(code),
+			Gains:  p.Totals.Gains.Format(code),
+			Basis:  p.Totals.Basis.Format(code),
+			Tax:    p.Totals.Tax.Format(code),
+		},
+	}
+	for _, lot := range p.Lots {
+		out.Lots = append(out.Lots, jsonLot{
+			Lot:      lot.Index,
+			Acquired: lot.Acquired.Format(statement.DateFormat),
+			LongTerm: lot.LongTerm.Format(statement.DateFormat),
+			Term:     lot.term(),
+			Shares:   lot.Shares,
+			Value:    lot.Price.Format(code),
+			Basis:    lot.Basis.Format(code),
+			Gain:     lot.Gain.Format(code),
+		})
+	}
+	for _, b := range p.Bindings {
+		out.Bindings = append(out.Bindings, jsonBinding{Constraint: b.Constraint, Lots: b.Lots})
+	}
+	if s := p.Solver; s != nil {
+		out.Solver = &jsonSolver{
+			Optimal:   s.Optimal,
+			Aborted:   s.Aborted,
+			Objective: s.Objective.Format(code),
+			Bound:     s.Bound.Format(code),
+			Gap:       (s.Bound - s.Objective).Format(code),
+		}
+	}
+	if p.Totals.Basis != 0 {
+		// The gain as a percentage of cost basis is omitted if the basis is zero.
+		pct := 100 * float64(p.Totals.Gains) / float64(p.Totals.Basis)
+		out.Totals.GainPercent = &pct
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// WriteCSV writes the lots of p to w as CSV, one row per lot giving the lot
+// number, acquisition date, shares sold, value per share, the gain and cost
+// basis of the shares sold, the first date on which a sale is long-term, and
+// the term of the sale, followed by a row of totals.
+func WriteCSV(w io.Writer, p *Plan) error {
+	code := p.Params.Currency
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{
+		"Lot", "Acquired", "Shares", "Value", "Gain", "Cost Basis", "Long-Term Date", "Term",
+	}); err != nil {
+		return err
+	}
+	for _, lot := range p.Lots {
+		n := currency.Value(lot.Shares)
+		if err := cw.Write([]string{
+			fmt.Sprint(lot.Index),
+			lot.Acquired.Format(statement.DateFormat),
+			fmt.Sprint(lot.Shares),
+			lot.Price.Format(code),
+			(n * lot.Gain).Format(code),
+			(n * lot.Basis).Format(code),
+			lot.LongTerm.Format(statement.DateFormat),
+			lot.term(),
+		}); err != nil {
+			return err
+		}
+	}
+	t := p.Totals
+	if err := cw.Write([]string{
+		"Total", "", fmt.Sprint(t.Shares), t.Value.Format(code), t.Gains.Format(code), t.Basis.Format(code), "", "",
+	}); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteCanonical writes the lots of p to w in a deterministic text format
+// designed to diff cleanly between plans. The format is:
+//
+//   - A header line naming the columns.
+//   - One line per lot sold, in increasing order of lot number, giving the lot
+//     number, acquisition date (YYYY-MM-DD), shares sold, value and gain per
+//     share, and the total proceeds, cost basis, and gain of the lot.
+//   - A line of totals for the plan.
+//
+// Columns are right-aligned to fixed widths, and amounts are plain units and
+// cents with no currency symbol or grouping.
+func WriteCanonical(w io.Writer, p *Plan) error {
+	lots := append([]Lot(nil), p.Lots...)
+	sort.Slice(lots, func(i, j int) bool { return lots[i].Index < lots[j].Index })
+	const row = "%5s %10s %8s %12s %12s %14s %14s %14s\n"
+	if _, err := fmt.Fprintf(w, row, "lot", "acquired", "shares", "value", "gain",
+		"proceeds", "basis", "total-gain"); err != nil {
+		return err
+	}
+	for _, lot := range lots {
+		n := currency.Value(lot.Shares)
+		if _, err := fmt.Fprintf(w, row, fmt.Sprint(lot.Index), lot.Acquired.Format(statement.DateFormat),
+			fmt.Sprint(lot.Shares), lot.Price.Decimal(), lot.Gain.Decimal(),
+			(n * lot.Price).Decimal(), (n * lot.Basis).Decimal(), (n * lot.Gain).Decimal()); err != nil {
+			return err
+		}
+	}
+	t := p.Totals
+	_, err := fmt.Fprintf(w, row, "total", "", fmt.Sprint(t.Shares), "", "",
+		t.Value.Decimal(), t.Basis.Decimal(), t.Gains.Decimal())
+	return err
+}
@@ -0,0 +1,133 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/report"
+)
+
+// testPlan returns a plan selling from two lots, one acquired late in the day
+// in a zone west of UTC, so a date taken in UTC would be the day after.
+func testPlan() *report.Plan {
+	pst := time.FixedZone("PST", -8*60*60)
+	return &report.Plan{
+		Params: report.Params{SaleDate: "2025-10-01", MinAge: "1y"},
+		Lots: []report.Lot{{
+			Index:    1,
+			Acquired: time.Date(2021, 3, 4, 23, 30, 0, 0, pst),
+			LongTerm: time.Date(2022, 3, 5, 0, 0, 0, 0, pst),
+			Long:     true,
+			Shares:   2,
+			Price:    100 * currency.Dollars,
+			Basis:    40 * currency.Dollars,
+			Gain:     60 * currency.Dollars,
+		}, {
+			Index:    2,
+			Acquired: time.Date(2022, 11, 15, 0, 0, 0, 0, time.UTC),
+			LongTerm: time.Date(2023, 11, 16, 0, 0, 0, 0, time.UTC),
+			Shares:   1,
+			Price:    100 * currency.Dollars,
+			Basis:    90 * currency.Dollars,
+			Gain:     10 * currency.Dollars,
+		}},
+		Totals: report.Totals{
+			Shares: 3,
+			Value:  300 * currency.Dollars,
+			Gains:  130 * currency.Dollars,
+			Basis:  170 * currency.Dollars,
+		},
+	}
+}
+
+// The acquisition and long-term dates, and the terms, of the lots of testPlan.
+var (
+	wantDates    = []string{"2021-03-04", "2022-11-15"}
+	wantLongTerm = []string{"2022-03-05", "2023-11-16"}
+	wantTerms    = []string{"LT", "ST"}
+)
+
+func TestWriteCanonicalDates(t *testing.T) {
+	var buf bytes.Buffer
+	if err := report.WriteCanonical(&buf, testPlan()); err != nil {
+		t.Fatalf("WriteCanonical: unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("WriteCanonical: got %d lines, want 4:\n%s", len(lines), buf.String())
+	}
+	for i, want := range wantDates {
+		if got := strings.Fields(lines[i+1])[1]; got != want {
+			t.Errorf("WriteCanonical: lot %d acquired %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+func TestWriteCSVDates(t *testing.T) {
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf, testPlan()); err != nil {
+		t.Fatalf("WriteCSV: unexpected error: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Reading CSV: %v", err)
+	}
+	if len(rows) != 4 || rows[0][1] != "Acquired" || rows[0][6] != "Long-Term Date" || rows[0][7] != "Term" {
+		t.Fatalf("WriteCSV: got rows %q, want a header, two lots, and totals", rows)
+	}
+	for i, want := range wantDates {
+		row := rows[i+1]
+		if got := row[1]; got != want {
+			t.Errorf("WriteCSV: lot %d acquired %q, want %q", i+1, got, want)
+		}
+		if got := row[6]; got != wantLongTerm[i] {
+			t.Errorf("WriteCSV: lot %d long-term on %q, want %q", i+1, got, wantLongTerm[i])
+		}
+		if got := row[7]; got != wantTerms[i] {
+			t.Errorf("WriteCSV: lot %d term %q, want %q", i+1, got, wantTerms[i])
+		}
+	}
+}
+
+func TestWriteJSONDates(t *testing.T) {
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf, testPlan()); err != nil {
+		t.Fatalf("WriteJSON: unexpected error: %v", err)
+	}
+	var out struct {
+		Params struct {
+			SaleDate string `json:"sale_date"`
+		} `json:"params"`
+		Lots []struct {
+			Acquired string `json:"acquired"`
+			LongTerm string `json:"long_term_date"`
+			Term     string `json:"term"`
+		} `json:"lots"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("Decoding JSON: %v", err)
+	}
+	if out.Params.SaleDate != "2025-10-01" {
+		t.Errorf("WriteJSON: sale date %q, want %q", out.Params.SaleDate, "2025-10-01")
+	}
+	if len(out.Lots) != len(wantDates) {
+		t.Fatalf("WriteJSON: got %d lots, want %d", len(out.Lots), len(wantDates))
+	}
+	for i, want := range wantDates {
+		lot := out.Lots[i]
+		if lot.Acquired != want {
+			t.Errorf("WriteJSON: lot %d acquired %q, want %q", i+1, lot.Acquired, want)
+		}
+		if lot.LongTerm != wantLongTerm[i] {
+			t.Errorf("WriteJSON: lot %d long-term on %q, want %q", i+1, lot.LongTerm, wantLongTerm[i])
+		}
+		if lot.Term != wantTerms[i] {
+			t.Errorf("WriteJSON: lot %d term %q, want %q", i+1, lot.Term, wantTerms[i])
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package solver
+
+import (
+	"math"
+	"sort"
+
+	"github.com/creachadair/stockopt/currency"
+)
+
+// ExactLimit is the largest number of entries for which SolveForProceeds
+// searches for a plan of least gain unless Options.Exact is set.
+const ExactLimit = 16
+
+// maxExactNodes bounds an exact search unless Options.Exact is set. If the
+// search does not finish within the bound, the best plan it has found is not
+// known to be optimal, and Solve reports how far it may be from optimal.
+const maxExactNodes = 1 << 20
+
+// Diagnostics describe how Solve found a plan, and how close the plan is to
+// optimal. The objective of a plan is its total value, or its total value net
+// of tax if AfterTax is set.
+type Diagnostics struct {
+	Objective currency.Value // the objective of the plan
+	Bound     currency.Value // no plan has an objective greater than this
+	Optimal   bool           // whether no plan has a greater objective
+	Aborted   bool           // whether the search stopped before it finished
+	Nodes     int            // the number of nodes visited by the search
+}
+
+// Gap returns the amount by which the objective of an optimal plan may exceed
+// that of the plan.
+func (d Diagnostics) Gap() currency.Value { return d.Bound - d.Objective }
+
+// objective returns the total value of c, or its value net of tax if AfterTax
+// is set.
+func (s *Solver) objective(c cell) currency.Value {
+	if s.opts.afterTax() {
+		return c.TotalNet
+	}
+	return c.TotalValue
+}
+
+// perShare returns the objective of one share of e.
+func (s *Solver) perShare(e Entry) currency.Value {
+	if s.opts.afterTax() {
+		return e.net()
+	}
+	return e.Value
+}
+
+// A search is the state of a branch-and-bound search for an optimal plan.
+type search struct {
+	s       *Solver
+	cap     currency.Value
+	order   []int   // indexes of s.entries, losses first, then by objective per unit gain
+	applies [][]int // the indexes of the limits that apply to each entry of order
+	bounded []bool  // which limits the bound respects
+	room    []float64
+
+	take  []int // shares taken from each entry of order, at the current node
+	best  cell  // the best plan found; None if there is none yet
+	found []int // shares of each entry of order in best, if it improves on the incumbent
+
+	nodes, maxNodes int
+	aborted         bool
+}
+
+// exact returns soln, a plan under cap found by the table, or a better plan if
+// an exact search finds one, together with the diagnostics of the result.
+func (s *Solver) exact(soln []Entry, cap currency.Value) ([]Entry, Diagnostics) {
+	x := &search{s: s, cap: cap, take: make([]int, len(s.entries))}
+	for i := range s.entries {
+		x.order = append(x.order, i)
+	}
+	ratio := func(e Entry) float64 { return float64(s.perShare(e)) / float64(e.Gain) }
+	sort.SliceStable(x.order, func(i, j int) bool {
+		a, b := s.entries[x.order[i]], s.entries[x.order[j]]
+		if (a.Gain <= 0) != (b.Gain <= 0) {
+			return a.Gain <= 0
+		} else if a.Gain <= 0 {
+			return false
+		}
+		return ratio(a) > ratio(b)
+	})
+	for _, k := range x.order {
+		x.applies = append(x.applies, s.limitsFor(s.entries[k]))
+	}
+	x.bounded = x.laminar()
+	x.room = make([]float64, len(x.bounded))
+	var inc cell // the plan of the table
+	for _, e := range soln {
+		inc.TotalValue += e.Value * currency.Value(e.N)
+		inc.TotalNet += e.net() * currency.Value(e.N)
+		inc.Shares += e.N
+		inc.Lots++
+	}
+	x.best = inc
+	x.best.None = !s.feasible(soln, cap)
+
+	lg := make([]currency.Value, len(s.opts.limits()))
+	d := Diagnostics{Bound: currency.Value(math.Ceil(x.bound(0, float64(cap), lg)))}
+	if !s.opts.exact() {
+		x.maxNodes = maxExactNodes
+	}
+	x.visit(0, cell{}, 0, lg)
+	d.Aborted, d.Nodes = x.aborted, x.nodes
+	if x.found != nil {
+		// Report the plan in the order of the table, as Solve does.
+		ns := make([]int, len(s.entries))
+		for i, k := range x.order {
+			ns[k] = x.found[i]
+		}
+		soln = soln[:0]
+		for k, n := range ns {
+			if n > 0 {
+				soln = append(soln, s.entries[k].take(n))
+			}
+		}
+	}
+	if x.best.None {
+		// The plan of the table is not within the limits, and the search found
+		// no other, so nothing is known of its optimality.
+		d.Objective = s.objective(inc)
+		return soln, d
+	}
+	d.Objective = s.objective(x.best)
+	if !x.aborted {
+		d.Bound = d.Objective
+	}
+	d.Optimal = d.Objective >= d.Bound
+	return soln, d
+}
+
+// feasible reports whether soln respects cap and the limits, and if
+// ForbidNetLoss is set, whether its total gain is not negative.
+func (s *Solver) feasible(soln []Entry, cap currency.Value) bool {
+	lims := s.opts.limits()
+	lg := make([]currency.Value, len(lims))
+	var gain currency.Value
+	for _, e := range soln {
+		g := e.Gain * currency.Value(e.N)
+		gain += g
+		for _, l := range s.limitsFor(e) {
+			lg[l] += g
+		}
+	}
+	if gain > cap || (s.opts.forbidNetLoss() && gain < 0) {
+		return false
+	}
+	for l, lim := range lims {
+		if lg[l] > lim.Cap {
+			return false
+		}
+	}
+	return true
+}
+
+// laminar reports which limits the bound respects: a family of limits in
+// which the entries of any two are either disjoint or nested, chosen in order
+// of the limits. For such a family, spending a budget in order of objective
+// per unit gain within the room left by each limit is optimal when fractional
+// shares may be sold, and the other limits may be dropped from the relaxed
+// problem without invalidating the bound.
+func (x *search) laminar() []bool {
+	lims := x.s.opts.limits()
+	sets := make([]map[int]bool, len(lims))
+	for i, ls := range x.applies {
+		for _, l := range ls {
+			if sets[l] == nil {
+				sets[l] = make(map[int]bool)
+			}
+			sets[l][i] = true
+		}
+	}
+	// compatible reports whether a and b are disjoint or nested.
+	compatible := func(a, b map[int]bool) bool {
+		var both int
+		for i := range a {
+			if b[i] {
+				both++
+			}
+		}
+		return both == 0 || both == len(a) || both == len(b)
+	}
+	out := make([]bool, len(lims))
+	for l := range lims {
+		out[l] = true
+		for m := range l {
+			if out[m] && !compatible(sets[l], sets[m]) {
+				out[l] = false
+				break
+			}
+		}
+	}
+	return out
+}
+
+// bound returns an upper bound on the objective of the shares of the entries
+// from position i of the order, with total gain at most budget and per-limit
+// totals lg so far. It is the optimum of the relaxed problem in which
+// fractional shares may be sold and only the limits chosen by laminar apply:
+// every share with a loss is sold, adding to the budget and the room of its
+// limits, and the budget is then spent in order of objective per unit gain
+// within the room left by each limit.
+func (x *search) bound(i int, budget float64, lg []currency.Value) float64 {
+	lims := x.s.opts.limits()
+	for l, lim := range lims {
+		x.room[l] = float64(lim.Cap) - float64(lg[l])
+	}
+	var ub float64
+	for j, k := range x.order[i:] {
+		e := x.s.entries[k]
+		v, n, g := float64(x.s.perShare(e)), float64(e.N), float64(e.Gain)
+		if g <= 0 {
+			ub += math.Max(v, 0) * n
+			budget -= g * n
+			for _, l := range x.applies[i+j] {
+				x.room[l] -= g * n
+			}
+			continue
+		} else if v <= 0 {
+			continue
+		} else if budget <= 0 {
+			break
+		}
+		m := math.Min(n, budget/g)
+		for _, l := range x.applies[i+j] {
+			if x.bounded[l] {
+				m = math.Min(m, math.Max(x.room[l], 0)/g)
+			}
+		}
+		ub += v * m
+		budget -= g * m
+		for _, l := range x.applies[i+j] {
+			x.room[l] -= g * m
+		}
+	}
+	return ub
+}
+
+// visit searches the plans taking shares from the entries at position i of
+// the order onward, given the current plan c with total gain gain and
+// per-limit totals lg. Entries with a loss come first in the order, so once
+// an entry with a gain is reached the totals only increase, and a plan over a
+// cap at that point cannot be completed within it.
+func (x *search) visit(i int, c cell, gain currency.Value, lg []currency.Value) {
+	s := x.s
+	x.nodes++
+	if x.maxNodes > 0 && x.nodes > x.maxNodes {
+		x.aborted = true
+		return
+	}
+	lims := s.opts.limits()
+	if i == len(x.order) {
+		if gain > x.cap || (s.opts.forbidNetLoss() && gain < 0) {
+			return
+		}
+		for l, lim := range lims {
+			if lg[l] > lim.Cap {
+				return
+			}
+		}
+		if x.best.None || s.better(c, x.best) {
+			x.best = c
+			x.found = append(x.found[:0], x.take...)
+		}
+		return
+	}
+
+	// Prune the plans that cannot improve on the best plan found, if any.
+	// Objectives are whole millicents, so a better plan exceeds the best by
+	// at least one, but with Compact a plan of equal objective may still be
+	// better. The margins allow for rounding in the bound.
+	ub := float64(s.objective(c)) + x.bound(i, float64(x.cap)-float64(gain), lg)
+	if !x.best.None {
+		best := float64(s.objective(x.best))
+		if ub < best-0.5 || (ub < best+0.5 && !s.opts.compact()) {
+			return
+		}
+	}
+
+	e := s.entries[x.order[i]]
+	applies := x.applies[i]
+	n := e.N
+	if e.Gain > 0 {
+		if gain > x.cap {
+			return
+		} else if room := headroom(x.cap, gain) / e.Gain; room < currency.Value(n) {
+			n = int(room)
+		}
+		for _, l := range applies {
+			if lg[l] > lims[l].Cap {
+				return
+			} else if room := headroom(lims[l].Cap, lg[l]) / e.Gain; room < currency.Value(n) {
+				n = int(room)
+			}
+		}
+	}
+	next := make([]currency.Value, len(lg))
+	for ; n >= 0 && !x.aborted; n-- {
+		g := e.Gain * currency.Value(n)
+		copy(next, lg)
+		for _, l := range applies {
+			next[l] += g
+		}
+		nc := c
+		nc.TotalValue += e.Value * currency.Value(n)
+		nc.TotalGain += g
+		nc.TotalNet += e.net() * currency.Value(n)
+		nc.Shares += n
+		if n > 0 {
+			nc.Lots++
+		}
+		x.take[i] = n
+		x.visit(i+1, nc, gain+g, next)
+	}
+	x.take[i] = 0
+}
+
+// headroom returns cap - gain, or currency.MaxValue if the difference is too
+// large to represent.
+func headroom(cap, gain currency.Value) currency.Value {
+	if d := cap - gain; gain >= 0 || d >= cap {
+		return d
+	}
+	return currency.MaxValue
+}
@@ -0,0 +1,210 @@
+package solver
+
+import (
+	"math"
+
+	"github.com/creachadair/stockopt/currency"
+)
+
+// A raise is the state of a branch-and-bound search for a plan raising a
+// target value with the least total gain.
+type raise struct {
+	s      *Solver
+	es     []Entry // the entries, in nondecreasing order of gain per unit value
+	target currency.Value
+	ratio  float64 // the MaxGainRatio, or 0
+
+	// Totals over the entries from each position onward, for pruning.
+	value []currency.Value // the value of every share
+	gain  []currency.Value // the gain of every share with a gain
+
+	take  []int // shares taken from each entry, at the current node
+	best  raised
+	found []int // shares of each entry in best, if it improves on the incumbent
+
+	nodes, maxNodes int
+	aborted         bool
+}
+
+// A raised summarizes a plan found by a raise.
+type raised struct {
+	Gain         currency.Value
+	Lots, Shares int
+	None         bool // no plan has been found
+}
+
+// better reports whether a is a better plan than b.
+func (a raised) better(b raised) bool {
+	if a.Gain != b.Gain {
+		return a.Gain < b.Gain
+	} else if a.Lots != b.Lots {
+		return a.Lots < b.Lots
+	}
+	return a.Shares < b.Shares
+}
+
+// searchProceeds searches es, in nondecreasing order of gain per unit value,
+// for a plan raising at least target that improves on soln, or if ok is false,
+// for any plan satisfying the constraints. It returns nil if the search finds
+// no such plan. Unless Exact is set, the search visits at most maxExactNodes.
+func (s *Solver) searchProceeds(es []Entry, target currency.Value, soln []Entry, ok bool) []Entry {
+	n := len(es)
+	x := &raise{
+		s: s, es: es, target: target, ratio: s.opts.maxGainRatio(),
+		value: make([]currency.Value, n+1),
+		gain:  make([]currency.Value, n+1),
+		take:  make([]int, n),
+		best:  raised{None: !ok},
+	}
+	for i := n - 1; i >= 0; i-- {
+		e := es[i]
+		x.value[i] = x.value[i+1] + e.Value*currency.Value(e.N)
+		x.gain[i] = x.gain[i+1] + max(e.Gain, 0)*currency.Value(e.N)
+	}
+	if ok {
+		x.best.Gain = 0
+		for _, e := range soln {
+			x.best.Gain += e.Gain * currency.Value(e.N)
+			x.best.Shares += e.N
+			x.best.Lots++
+		}
+	}
+	if !s.opts.exact() {
+		x.maxNodes = maxExactNodes
+	}
+	x.visit(0, 0, raised{})
+	if x.found == nil {
+		return nil
+	}
+	var out []Entry
+	for i, n := range x.found {
+		if n > 0 {
+			out = append(out, es[i].take(n))
+		}
+	}
+	return out
+}
+
+// feasible reports whether a plan with the given totals satisfies the
+// MaxGainRatio and, if ForbidNetLoss is set, does not realize a net loss.
+func (x *raise) feasible(value, gain currency.Value) bool {
+	if gain < 0 && x.s.opts.forbidNetLoss() {
+		return false
+	}
+	return x.ratio <= 0 || float64(gain) <= x.ratio*float64(value)
+}
+
+// bound returns a lower bound on the gain of the shares of the entries from
+// position i onward needed to raise need. It is the optimum of the relaxed
+// problem in which fractional shares may be sold and the constraints do not
+// apply: every share with a loss is sold, and the remainder of need is then
+// raised in order of gain per unit value. It returns +Inf if need cannot be
+// raised.
+func (x *raise) bound(i int, need currency.Value) float64 {
+	var lb float64
+	rest := float64(need)
+	for _, e := range x.es[i:] {
+		v, n, g := float64(e.Value), float64(e.N), float64(e.Gain)
+		if g < 0 {
+			lb += g * n
+			rest -= v * n
+			continue
+		} else if rest <= 0 {
+			break
+		}
+		m := math.Min(n, rest/v)
+		lb += g * m
+		rest -= v * m
+	}
+	if rest > 0.5 {
+		return math.Inf(1)
+	}
+	return lb
+}
+
+// excess returns a lower bound on the amount by which the gain of the shares
+// of the entries from position i onward needed to raise need exceeds the
+// MaxGainRatio of their value. In the relaxed problem in which fractional
+// shares may be sold, every share within the ratio is sold, and the remainder
+// of need is then raised in order of gain per unit value. A plan can satisfy
+// the ratio only if its excess so far and this bound total at most zero.
+func (x *raise) excess(i int, need currency.Value) float64 {
+	var lb float64
+	rest := float64(need)
+	for _, e := range x.es[i:] {
+		v, n := float64(e.Value), float64(e.N)
+		d := float64(e.Gain) - x.ratio*v // the excess of one share
+		if d < 0 {
+			lb += d * n
+			rest -= v * n
+			continue
+		} else if rest <= 0 {
+			break
+		}
+		m := math.Min(n, rest/v)
+		lb += d * m
+		rest -= v * m
+	}
+	return lb
+}
+
+// visit searches the plans taking shares from the entries at position i
+// onward, given the current plan c with total value value.
+func (x *raise) visit(i int, value currency.Value, c raised) {
+	x.nodes++
+	if x.maxNodes > 0 && x.nodes > x.maxNodes {
+		x.aborted = true
+		return
+	}
+	gain := c.Gain
+	if value >= x.target && x.feasible(value, gain) && (i == len(x.es) || x.es[i].Gain >= 0) {
+		// No entry remaining has a loss, so taking more shares cannot lower
+		// the gain, nor leave fewer lots or shares.
+		if x.best.None || c.better(x.best) {
+			x.best = c
+			x.found = append(x.found[:0], x.take...)
+		}
+		return
+	} else if i == len(x.es) {
+		return
+	}
+
+	// Prune the plans that cannot reach the target, satisfy the constraints,
+	// or improve on the best plan found. Gains are whole millicents, and a
+	// plan of equal gain may still be better; the margin allows for rounding
+	// in the bound.
+	if value+x.value[i] < x.target {
+		return
+	} else if x.s.opts.forbidNetLoss() && gain+x.gain[i] < 0 {
+		return
+	} else if x.ratio > 0 && float64(gain)-x.ratio*float64(value)+x.excess(i, x.target-value) > 0.5 {
+		return
+	}
+	lb := float64(gain) + x.bound(i, x.target-value)
+	if x.s.opts.forbidNetLoss() {
+		lb = math.Max(lb, 0)
+	}
+	if !x.best.None && lb > float64(x.best.Gain)+0.5 {
+		return
+	}
+
+	e := x.es[i]
+	n := e.N
+	if x.ratio <= 0 && !x.s.opts.forbidNetLoss() && e.Gain >= 0 {
+		// Only the constraints can require more shares than the target needs.
+		if need := (x.target - value + e.Value - 1) / e.Value; need < currency.Value(n) {
+			n = int(max(need, 0))
+		}
+	}
+	for ; n >= 0 && !x.aborted; n-- {
+		nc := c
+		nc.Gain += e.Gain * currency.Value(n)
+		nc.Shares += n
+		if n > 0 {
+			nc.Lots++
+		}
+		x.take[i] = n
+		x.visit(i+1, value+e.Value*currency.Value(n), nc)
+	}
+	x.take[i] = 0
+}
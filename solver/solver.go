@@ -2,6 +2,7 @@
 package solver
 
 import (
+	"slices"
 	"sort"
 
 	"github.com/creachadair/stockopt/currency"
@@ -10,12 +11,17 @@ import (
 // An Entry represents a number of shares having a common price (value) and
 // capital gain per share.
 type Entry struct {
-	ID    interface{}    // opaque identifier
-	N     int            // number of shares
-	Value currency.Value // value per share
-	Gain  currency.Value // gain per share
+	ID       interface{}    // opaque identifier
+	N        int            // number of shares
+	Value    currency.Value // value per share
+	Gain     currency.Value // gain per share
+	LongTerm bool           // whether the gain is long-term
+	TaxRate  float64        // tax rate on the gain (percent), for AfterTax
 }
 
+// net returns the value per share of e net of the tax on its gain.
+func (e Entry) net() currency.Value { return e.Value - e.Gain.Percent(e.TaxRate) }
+
 func (e Entry) take(n int) Entry {
 	e.N = n
 	return e
@@ -24,24 +30,237 @@ func (e Entry) take(n int) Entry {
 type cell struct {
 	TotalValue currency.Value
 	TotalGain  currency.Value
+	TotalNet   currency.Value   // total value net of tax, for AfterTax
+	Limited    []currency.Value // total gain per limit; empty means all zero
+	Shares     int              // total shares sold
+	Lots       int              // total entries sold from
 	Next       int
+	None       bool // no plan within the cap sells this many shares
+}
+
+// A Limit caps the total gain of a subset of the entries, in addition to the
+// overall gains cap.
+type Limit struct {
+	Name    string           // a label for the limit, reported in bindings
+	Cap     currency.Value   // the maximum total gain of matching entries
+	Applies func(Entry) bool // reports whether the limit applies to an entry
+}
+
+// Options control the behaviour of a solver.
+type Options struct {
+	// If true, break ties between plans of equal total value by preferring
+	// the plan that sells fewer shares, and then the plan that sells from
+	// fewer entries.
+	Compact bool
+
+	// If positive, SolveForProceeds only returns plans whose total gain is at
+	// most this fraction of their total value.
+	MaxGainRatio float64
+
+	// Additional caps on the total gain of subsets of the entries, respected
+	// by Solve and SolveInOrder.
+	Limits []Limit
+
+	// If true, entries with a loss (negative gain) are never sold.
+	ExcludeLosses bool
+
+	// If true, no plan realizes a net loss: the total gain of the plan is not
+	// negative, even if it includes entries with a loss.
+	ForbidNetLoss bool
+
+	// If true, Solve maximizes the total value net of the tax on the gain of
+	// each entry at its TaxRate, rather than the total value.
+	AfterTax bool
+
+	// If true, Solve and SolveForProceeds search for a provably optimal plan
+	// however long the search takes. Otherwise the search of Solve stops
+	// after a fixed number of steps, and SolveForProceeds searches only for
+	// at most ExactLimit entries.
+	Exact bool
+}
+
+func (o *Options) compact() bool       { return o != nil && o.Compact }
+func (o *Options) excludeLosses() bool { return o != nil && o.ExcludeLosses }
+func (o *Options) forbidNetLoss() bool { return o != nil && o.ForbidNetLoss }
+func (o *Options) afterTax() bool      { return o != nil && o.AfterTax }
+func (o *Options) exact() bool         { return o != nil && o.Exact }
+
+func (o *Options) limits() []Limit {
+	if o == nil {
+		return nil
+	}
+	return o.Limits
+}
+
+func (o *Options) maxGainRatio() float64 {
+	if o == nil {
+		return 0
+	}
+	return o.MaxGainRatio
 }
 
 // A Solver represents the optimizer state for a collection of entries.
 type Solver struct {
-	entries []Entry
+	order   []Entry // entries in the order given
+	entries []Entry // entries in nonincreasing order of gain, once initialized
+	opts    *Options
 	table   [][]cell // one column per entry
+	applies [][]int  // for each entry, the indexes of the limits that apply
+}
+
+// New contructs a solver from a collection of entries. If opts == nil,
+// default options are used.
+func New(es []Entry, opts *Options) *Solver {
+	if opts.excludeLosses() {
+		var keep []Entry
+		for _, e := range es {
+			if e.Gain >= 0 {
+				keep = append(keep, e)
+			}
+		}
+		es = keep
+	}
+	return &Solver{order: es, entries: append([]Entry(nil), es...), opts: opts}
 }
 
-// New contructs a solver from a collection of entries.
-func New(es []Entry) *Solver { return &Solver{entries: es} }
+// repair returns soln, trimmed if ForbidNetLoss is set so that its total gain
+// is not negative. Shares having the largest loss per share are removed first,
+// as they restore the most gain for the value given up. Removing shares with a
+// loss raises the total gain, so if the plan then exceeds cap or a limit,
+// shares with a gain are removed in turn, those giving up the least objective
+// per unit of gain first, until the plan respects every constraint.
+func (s *Solver) repair(soln []Entry, cap currency.Value) []Entry {
+	if !s.opts.forbidNetLoss() {
+		return soln
+	}
+	lims := s.opts.limits()
+	applies := make([][]int, len(soln))
+	for i, e := range soln {
+		applies[i] = s.limitsFor(e)
+	}
+	ratio := func(e Entry) float64 { return float64(s.perShare(e)) / float64(e.Gain) }
 
-// Solve returns an optimal sale plan for which the total capital gains do not
-// exceed cap.
-func (s *Solver) Solve(cap currency.Value) []Entry {
-	var soln []Entry
+	// Losses in nonincreasing order of loss per share, then gains in
+	// nondecreasing order of objective per unit gain, then the rest.
+	class := func(e Entry) int {
+		if e.Gain < 0 {
+			return 0
+		} else if e.Gain > 0 {
+			return 1
+		}
+		return 2
+	}
+	order := make([]int, len(soln))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := soln[order[i]], soln[order[j]]
+		ca, cb := class(a), class(b)
+		if ca != cb {
+			return ca < cb
+		} else if ca == 0 {
+			return a.Gain < b.Gain
+		}
+		return ca == 1 && ratio(a) < ratio(b)
+	})
 
+	// remove takes shares from the entries of order accepted by ok, in order,
+	// until excess is covered or nothing is left. It reports whether any
+	// share was removed.
+	remove := func(excess currency.Value, ok func(int) bool) bool {
+		removed := false
+		for _, i := range order {
+			e := &soln[i]
+			if excess <= 0 {
+				break
+			} else if e.N == 0 || !ok(i) {
+				continue
+			}
+			g := e.Gain
+			if g < 0 {
+				g = -g
+			}
+			n := int((excess + g - 1) / g)
+			if n > e.N {
+				n = e.N
+			}
+			e.N -= n
+			excess -= g * currency.Value(n)
+			removed = true
+		}
+		return removed
+	}
+	for {
+		var gain currency.Value
+		lg := make([]currency.Value, len(lims))
+		for i, e := range soln {
+			g := e.Gain * currency.Value(e.N)
+			gain += g
+			for _, l := range applies[i] {
+				lg[l] += g
+			}
+		}
+		if gain < 0 {
+			if remove(-gain, func(i int) bool { return soln[i].Gain < 0 }) {
+				continue
+			}
+		} else if gain > cap {
+			if remove(gain-cap, func(i int) bool { return soln[i].Gain > 0 }) {
+				continue
+			}
+		}
+		over := false
+		for l, lim := range lims {
+			if lg[l] <= lim.Cap {
+				continue
+			}
+			over = remove(lg[l]-lim.Cap, func(i int) bool {
+				return soln[i].Gain > 0 && slices.Contains(applies[i], l)
+			})
+			if over {
+				break
+			}
+		}
+		if !over {
+			break
+		}
+	}
+	out := soln[:0]
+	for _, e := range soln {
+		if e.N > 0 {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// better reports whether a is a better plan than b.
+func (s *Solver) better(a, b cell) bool {
+	av, bv := s.objective(a), s.objective(b)
+	if av != bv || !s.opts.compact() {
+		return av > bv
+	}
+	if a.Shares != b.Shares {
+		return a.Shares < b.Shares
+	}
+	return a.Lots < b.Lots
+}
+
+// Solve returns a sale plan for which the total capital gains do not exceed
+// cap, maximizing the total value, and diagnostics describing how close the
+// plan is to optimal. If ForbidNetLoss is set, the total gain of the plan is
+// not negative.
+//
+// The plan is first found from a table of the best plans selling each number
+// of shares of each entry, in order of gain. A branch-and-bound search then
+// looks for a better plan, and the result is provably optimal if the search
+// finishes. Unless Exact is set, the search stops after a fixed number of
+// steps, so the plan is not guaranteed to be optimal; if the search stops,
+// the diagnostics give an upper bound on the value of an optimal plan.
+func (s *Solver) Solve(cap currency.Value) ([]Entry, Diagnostics) {
 	ns := s.init(cap)
+	soln := make([]Entry, 0, len(s.entries))
 	for i, col := range s.table {
 		if ns > 0 {
 			soln = append(soln, s.entries[i].take(ns))
@@ -51,6 +270,412 @@ func (s *Solver) Solve(cap currency.Value) []Entry {
 	if ns != 0 {
 		panic("nonzero offset at end")
 	}
+	return s.exact(s.repair(soln, cap), cap)
+}
+
+// A Result describes a sale plan and the constraints that bound it.
+type Result struct {
+	Entries     []Entry      // the shares sold, one entry per lot
+	Bindings    []Binding    // the constraints at their limit, if any
+	Diagnostics *Diagnostics // how the plan was found, if by Solve
+}
+
+// A Binding records a constraint that is at its limit in a sale plan, together
+// with the entries the constraint prevents from selling more shares.
+type Binding struct {
+	Constraint string        // the name of the constraint, e.g., SoldOut
+	IDs        []interface{} // the IDs of the entries at the limit
+}
+
+// Names of the constraints reported in a binding.
+const (
+	SoldOut = "sold-out" // every share of the entry is sold
+	GainCap = "gain-cap" // another share of the entry would exceed the gains cap
+)
+
+// Analyze returns a Result for soln, a sale plan for the entries of s under
+// the given gains cap. If the plan had no gains cap, pass currency.MaxValue.
+// Each Limit in the options at its limit is reported as a binding with the
+// limit's name. Entry IDs must be comparable.
+func (s *Solver) Analyze(soln []Entry, cap currency.Value) *Result {
+	lims := s.opts.limits()
+	sold := make(map[interface{}]int)
+	var gain currency.Value
+	lg := make([]currency.Value, len(lims))
+	for _, e := range soln {
+		sold[e.ID] += e.N
+		g := e.Gain * currency.Value(e.N)
+		gain += g
+		for _, l := range s.limitsFor(e) {
+			lg[l] += g
+		}
+	}
+
+	// Bindings are reported in a fixed order: sold-out, the gains cap, then
+	// each limit in the order given.
+	ids := make([][]interface{}, 2+len(lims))
+	for _, e := range s.order {
+		if e.N == 0 {
+			continue
+		} else if sold[e.ID] >= e.N {
+			ids[0] = append(ids[0], e.ID)
+			continue
+		} else if e.Gain <= 0 {
+			continue
+		}
+		if gain+e.Gain > cap {
+			ids[1] = append(ids[1], e.ID)
+		}
+		for _, l := range s.limitsFor(e) {
+			if lg[l]+e.Gain > lims[l].Cap {
+				ids[2+l] = append(ids[2+l], e.ID)
+			}
+		}
+	}
+
+	res := &Result{Entries: soln}
+	for i, v := range ids {
+		if len(v) == 0 {
+			continue
+		}
+		name := SoldOut
+		if i == 1 {
+			name = GainCap
+		} else if i > 1 {
+			name = lims[i-2].Name
+		}
+		res.Bindings = append(res.Bindings, Binding{Constraint: name, IDs: v})
+	}
+	return res
+}
+
+// rank fills order with the indexes of the cells of col that record a plan, in
+// nondecreasing order of total gain, and best with the index of the best cell
+// among each prefix of order, preferring the lowest index among equally good
+// cells. It returns the updated slices. Because better compares plans by
+// quantities that combining with an assignment offsets equally, the best
+// prefix cell within a gain bound is the same cell a scan of col in index
+// order would choose.
+func (s *Solver) rank(col []cell, order, best []int) ([]int, []int) {
+	for k := range col {
+		if !col[k].None {
+			order = append(order, k)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return col[order[a]].TotalGain < col[order[b]].TotalGain
+	})
+	for p, k := range order {
+		if p > 0 {
+			if b := best[p-1]; !s.better(col[k], col[b]) && (s.better(col[b], col[k]) || b < k) {
+				k = b
+			}
+		}
+		best = append(best, k)
+	}
+	return order, best
+}
+
+// limitsFor returns the indexes of the limits that apply to e.
+func (s *Solver) limitsFor(e Entry) []int {
+	var out []int
+	for i, lim := range s.opts.limits() {
+		if lim.Applies(e) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// withinLimits reports whether adding gain g from entry i to the per-limit
+// totals in lg respects all the limits.
+func (s *Solver) withinLimits(i int, g currency.Value, lg []currency.Value) bool {
+	if s.applies == nil {
+		return true
+	}
+	lims := s.opts.limits()
+	for _, l := range s.applies[i] {
+		t := g
+		if len(lg) != 0 {
+			t += lg[l]
+		}
+		if t > lims[l].Cap {
+			return false
+		}
+	}
+	return true
+}
+
+// addLimited returns the per-limit totals in lg with gain g from entry i
+// added, reusing the storage of buf if possible.
+func (s *Solver) addLimited(i int, g currency.Value, lg, buf []currency.Value) []currency.Value {
+	n := len(s.opts.limits())
+	if n == 0 {
+		return nil
+	}
+	out := buf[:0]
+	if cap(out) < n {
+		out = make([]currency.Value, n)
+	} else {
+		out = out[:n]
+		clear(out)
+	}
+	copy(out, lg)
+	for _, l := range s.applies[i] {
+		out[l] += g
+	}
+	return out
+}
+
+// SolveInOrder returns a sale plan for which the total capital gains do not
+// exceed cap, taking shares strictly in the order the entries were given to
+// New, as a broker does when selling first-in, first-out. Each entry is sold in
+// full before any shares of the next are taken.
+func (s *Solver) SolveInOrder(cap currency.Value) []Entry {
+	var soln []Entry
+	var gain currency.Value
+	lims := s.opts.limits()
+	lg := make([]currency.Value, len(lims))
+	for _, e := range s.order {
+		n := e.N
+		applies := s.limitsFor(e)
+		if e.Gain > 0 {
+			if room := headroom(cap, gain) / e.Gain; room < currency.Value(n) {
+				n = int(room)
+			}
+			for _, l := range applies {
+				if room := headroom(lims[l].Cap, lg[l]) / e.Gain; room < currency.Value(n) {
+					n = int(room)
+				}
+			}
+		}
+		if n > 0 {
+			soln = append(soln, e.take(n))
+			g := e.Gain * currency.Value(n)
+			gain += g
+			for _, l := range applies {
+				lg[l] += g
+			}
+		}
+		if n < e.N {
+			break
+		}
+	}
+	return s.repair(soln, cap)
+}
+
+// SolveForProceeds returns a sale plan for which the total sale value is at
+// least target, minimizing the total capital gains realized. Among plans with
+// equal gains, it prefers the one selling from fewer lots, then fewer shares.
+// If the entries cannot reach target, the plan sells every share, which is
+// the closest achievable plan; callers should check the total value. If
+// ForbidNetLoss is set, the total gain of the plan is not negative, and if
+// MaxGainRatio is set, it is at most that fraction of the total value. If no
+// plan found satisfies these, SolveForProceeds returns nil.
+//
+// A greedy plan is constructed first, taking shares in nondecreasing order of
+// gain per unit of value, then trimming any excess the target does not need.
+// For at most ExactLimit entries, or if Exact is set, a branch-and-bound
+// search then finds a plan that is provably optimal. For more entries the
+// greedy plan is returned, and it may realize more gain than necessary,
+// unless it does not satisfy the constraints, in which case a bounded search
+// looks for one that does before giving up.
+func (s *Solver) SolveForProceeds(target currency.Value) []Entry {
+	es := make([]Entry, 0, len(s.entries))
+	var total currency.Value
+	for _, e := range s.entries {
+		if e.N > 0 && e.Value > 0 {
+			es = append(es, e)
+			total += e.Value * currency.Value(e.N)
+		}
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		ri := float64(es[i].Gain) / float64(es[i].Value)
+		rj := float64(es[j].Gain) / float64(es[j].Value)
+		if ri != rj {
+			return ri < rj
+		}
+		// For the same gain, larger lots first means fewer lots, and higher
+		// values per share means fewer shares.
+		vi := es[i].Value * currency.Value(es[i].N)
+		vj := es[j].Value * currency.Value(es[j].N)
+		if vi != vj {
+			return vi > vj
+		}
+		return es[i].Value > es[j].Value
+	})
+
+	if total < target {
+		// The target is not reachable; sell everything, or if that would
+		// realize a net loss that is forbidden, everything without a loss.
+		soln := es
+		if _, gain := sum(soln); gain < 0 && s.opts.forbidNetLoss() {
+			soln = nil
+			for _, e := range es {
+				if e.Gain >= 0 {
+					soln = append(soln, e)
+				}
+			}
+		}
+		if !s.withinRatio(soln) {
+			return nil
+		}
+		return soln
+	}
+
+	soln := greedyProceeds(es, target)
+	ok := s.proceedsOK(soln)
+	if !ok && s.opts.forbidNetLoss() {
+		// Fall back to a plan using only entries without a loss.
+		var keep []Entry
+		for _, e := range es {
+			if e.Gain >= 0 {
+				keep = append(keep, e)
+			}
+		}
+		soln = greedyProceeds(keep, target)
+		if v, _ := sum(soln); v >= target {
+			ok = s.proceedsOK(soln)
+		}
+	}
+	if s.opts.exact() || len(es) <= ExactLimit || !ok {
+		if found := s.searchProceeds(es, target, soln, ok); found != nil {
+			return found
+		}
+	}
+	if !ok {
+		return nil // no plan found satisfies the constraints
+	}
+	return soln
+}
+
+// greedyProceeds returns a plan selling at least target from es, which are in
+// nondecreasing order of gain per unit of value, or every share if target is
+// not reachable. Shares are taken in order until the target is met; then
+// excess shares are given back, those with the largest gain first.
+func greedyProceeds(es []Entry, target currency.Value) []Entry {
+	// Take shares in order until the target is met. The last entry taken may
+	// be partial.
+	var soln []Entry
+	need := target
+	for _, e := range es {
+		if need <= 0 {
+			break
+		}
+		n := int((need + e.Value - 1) / e.Value)
+		if n > e.N {
+			n = e.N
+		}
+		soln = append(soln, e.take(n))
+		need -= e.Value * currency.Value(n)
+	}
+	if need > 0 {
+		need = 0 // the target is not reachable; sell everything
+	}
+
+	// The greedy selection may overshoot the target. Give back excess shares,
+	// starting with those having the largest gain per share; shares with a
+	// loss are kept, since returning them would increase the gain.
+	excess := -need
+	order := make([]int, len(soln))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return soln[order[i]].Gain > soln[order[j]].Gain
+	})
+	for _, i := range order {
+		e := &soln[i]
+		if e.Gain < 0 {
+			break
+		}
+		n := int(excess / e.Value)
+		if n > e.N {
+			n = e.N
+		}
+		e.N -= n
+		excess -= e.Value * currency.Value(n)
+	}
+
+	out := soln[:0]
+	for _, e := range soln {
+		if e.N > 0 {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// sum returns the total value and gain of soln.
+func sum(soln []Entry) (value, gain currency.Value) {
+	for _, e := range soln {
+		value += e.Value * currency.Value(e.N)
+		gain += e.Gain * currency.Value(e.N)
+	}
+	return value, gain
+}
+
+// withinRatio reports whether the total gain of soln is within the
+// MaxGainRatio of its total value, if one is set.
+func (s *Solver) withinRatio(soln []Entry) bool {
+	value, gain := sum(soln)
+	r := s.opts.maxGainRatio()
+	return r <= 0 || float64(gain) <= r*float64(value)
+}
+
+// proceedsOK reports whether soln satisfies the MaxGainRatio and, if
+// ForbidNetLoss is set, does not realize a net loss.
+func (s *Solver) proceedsOK(soln []Entry) bool {
+	if _, gain := sum(soln); gain < 0 && s.opts.forbidNetLoss() {
+		return false
+	}
+	return s.withinRatio(soln)
+}
+
+// SolveForLoss returns a sale plan realizing a total capital loss of at least
+// target, selling only entries with a loss, for tax-loss harvesting. Among
+// such plans, it prefers the one selling the least total value, so that as
+// much of the portfolio as possible remains invested. If the entries cannot
+// realize target, the plan sells every share with a loss; callers should check
+// the total gain.
+//
+// The plan is constructed greedily, taking shares in nonincreasing order of
+// loss per unit of value, with ties broken as in SolveForProceeds. Only the
+// last entry taken may be partial.
+func (s *Solver) SolveForLoss(target currency.Value) []Entry {
+	var es []Entry
+	for _, e := range s.entries {
+		if e.N > 0 && e.Value > 0 && e.Gain < 0 {
+			es = append(es, e)
+		}
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		ri := float64(es[i].Gain) / float64(es[i].Value)
+		rj := float64(es[j].Gain) / float64(es[j].Value)
+		if ri != rj {
+			return ri < rj
+		}
+		vi := es[i].Value * currency.Value(es[i].N)
+		vj := es[j].Value * currency.Value(es[j].N)
+		if vi != vj {
+			return vi > vj
+		}
+		return es[i].Value > es[j].Value
+	})
+
+	var soln []Entry
+	need := target
+	for _, e := range es {
+		if need <= 0 {
+			break
+		}
+		n := int((need + -e.Gain - 1) / -e.Gain)
+		if n > e.N {
+			n = e.N
+		}
+		soln = append(soln, e.take(n))
+		need += e.Gain * currency.Value(n)
+	}
 	return soln
 }
 
@@ -68,33 +693,89 @@ func (s *Solver) init(cap currency.Value) int {
 
 		// s.table has one column per entry, plus a sentinel to simplify setup.
 		s.table = make([][]cell, len(s.entries)+1)
+		if len(s.opts.limits()) != 0 {
+			s.applies = make([][]int, len(s.entries))
+			for i, e := range s.entries {
+				s.applies[i] = s.limitsFor(e)
+			}
+		}
 
 		// Each column has one entry per possible number of shares assigned.
+		// The columns share a single allocation.
+		size := 1 // sentinel
+		for _, e := range s.entries {
+			size += e.N + 1
+		}
+		cells := make([]cell, size)
 		for i, e := range s.entries {
-			s.table[i] = make([]cell, e.N+1)
+			s.table[i], cells = cells[:e.N+1:e.N+1], cells[e.N+1:]
 		}
-		s.table[len(s.entries)] = make([]cell, 1) // sentinel
+		s.table[len(s.entries)] = cells // sentinel
 	}
 
+	// Without limits, whether a cell of the next column can be combined with
+	// an assignment depends only on its total gain. In that case, rank the
+	// cells of the next column by gain, so the best cell within the cap can
+	// be found by binary search rather than by scanning the column.
+	fast := len(s.opts.limits()) == 0
+	var order, prefix []int
 	for i := len(s.entries) - 1; i >= 0; i-- {
 		col := s.table[i] // this entry's column in the solution table
+		next := s.table[i+1]
+		if fast {
+			order, prefix = s.rank(next, order[:0], prefix[:0])
+		}
 
 		for j := range col {
+			// Discard the results of any previous solution, but keep storage.
+			col[j] = cell{Limited: col[j].Limited[:0], None: true}
+
 			// Value and gain of j shares of this entry.
 			v := s.entries[i].Value * currency.Value(j)
 			g := s.entries[i].Gain * currency.Value(j)
+			nv := s.entries[i].net() * currency.Value(j)
+			lot := 0
+			if j > 0 {
+				lot = 1
+			}
+			combine := func(k int) cell {
+				elt := next[k]
+				return cell{
+					TotalValue: v + elt.TotalValue,
+					TotalGain:  g + elt.TotalGain,
+					TotalNet:   nv + elt.TotalNet,
+					Shares:     j + elt.Shares,
+					Lots:       lot + elt.Lots,
+					Next:       k,
+				}
+			}
 
 			// Find the largest value we can combine with this assignment in
 			// the next column without blowing the cap. Update this entry's
 			// column to reflect that local optimum.
-			next := s.table[i+1]
+			if fast {
+				bound := cap - g
+				if g < 0 && bound < cap {
+					bound = currency.MaxValue // overflow
+				}
+				p := sort.Search(len(order), func(p int) bool {
+					return next[order[p]].TotalGain > bound
+				})
+				if p > 0 {
+					if c := combine(prefix[p-1]); col[j].None || s.better(c, col[j]) {
+						col[j] = c
+					}
+				}
+				continue
+			}
 			for k, elt := range next {
-				tv := v + elt.TotalValue
-				tg := g + elt.TotalGain
-				if tg <= cap && tv > col[j].TotalValue {
-					col[j].TotalValue = tv
-					col[j].TotalGain = tg
-					col[j].Next = k
+				if elt.None {
+					continue
+				}
+				c := combine(k)
+				if c.TotalGain <= cap && (col[j].None || s.better(c, col[j])) && s.withinLimits(i, g, elt.Limited) {
+					c.Limited = s.addLimited(i, g, elt.Limited, col[j].Limited)
+					col[j] = c
 				}
 			}
 		}
@@ -106,7 +787,7 @@ func (s *Solver) init(cap currency.Value) int {
 	seed := s.table[0]
 	best := 0
 	for i, c := range seed {
-		if c.TotalValue > seed[best].TotalValue {
+		if !c.None && (seed[best].None || s.better(c, seed[best])) {
 			best = i
 		}
 	}
@@ -0,0 +1,502 @@
+package solver_test
+
+import (
+	"maps"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/solver"
+)
+
+// totals returns the total value and gain of soln.
+func totals(soln []solver.Entry) (value, gain currency.Value) {
+	for _, e := range soln {
+		value += e.Value * currency.Value(e.N)
+		gain += e.Gain * currency.Value(e.N)
+	}
+	return value, gain
+}
+
+func TestLosses(t *testing.T) {
+	var es []solver.Entry
+	for i := range 17 {
+		es = append(es, solver.Entry{ID: i, N: 1, Value: 100 * currency.Dollars, Gain: 3 * currency.Dollars})
+	}
+	es = append(es, solver.Entry{ID: "loss", N: 1, Value: 100 * currency.Dollars, Gain: -10 * currency.Dollars})
+
+	t.Run("ForbidNetLoss", func(t *testing.T) {
+		for _, cap := range []currency.Value{0, 2 * currency.Dollars, 5 * currency.Dollars} {
+			soln, _ := solver.New(es, &solver.Options{ForbidNetLoss: true}).Solve(cap)
+			if _, gain := totals(soln); gain < 0 || gain > cap {
+				t.Errorf("Solve(%v): gain is %v, want between 0 and %v", cap, gain, cap)
+			}
+		}
+	})
+	t.Run("ExcludeLosses", func(t *testing.T) {
+		cap := currency.Value(9 * currency.Dollars)
+		soln, _ := solver.New(es, &solver.Options{ExcludeLosses: true}).Solve(cap)
+		for _, e := range soln {
+			if e.Gain < 0 {
+				t.Errorf("Solve(%v): plan sells %d shares of %v at a loss", cap, e.N, e.ID)
+			}
+		}
+		if value, gain := totals(soln); gain > cap || value != 300*currency.Dollars {
+			t.Errorf("Solve(%v): got value %v gain %v, want value $300.00 within the cap", cap, value, gain)
+		}
+	})
+	t.Run("Limits", func(t *testing.T) {
+		opts := &solver.Options{
+			ForbidNetLoss: true,
+			Limits: []solver.Limit{{
+				Name:    "even",
+				Cap:     0,
+				Applies: func(e solver.Entry) bool { i, ok := e.ID.(int); return ok && i%2 == 0 },
+			}},
+		}
+		soln, _ := solver.New(es, opts).Solve(currency.MaxValue)
+		if _, gain := totals(soln); gain < 0 {
+			t.Errorf("Solve: gain is %v, want at least 0", gain)
+		}
+		for _, e := range soln {
+			if i, ok := e.ID.(int); ok && i%2 == 0 {
+				t.Errorf("Solve: plan sells %d shares of %v, which is limited to no gain", e.N, e.ID)
+			}
+		}
+	})
+}
+
+func TestSolveInOrder(t *testing.T) {
+	es := []solver.Entry{
+		{ID: "loss", N: 2, Value: 10 * currency.Dollars, Gain: -5 * currency.Dollars},
+		{ID: "a", N: 3, Value: 10 * currency.Dollars, Gain: 4 * currency.Dollars},
+		{ID: "b", N: 1, Value: 10 * currency.Dollars, Gain: 6 * currency.Dollars},
+	}
+	tests := []struct {
+		cap   currency.Value
+		sold  int
+		gains currency.Value
+	}{
+		// The loss leaves more room than the largest cap can represent.
+		{currency.MaxValue, 6, 8 * currency.Dollars},
+		{1 * currency.Dollars, 4, -2 * currency.Dollars},
+		{4 * currency.Dollars, 5, 2 * currency.Dollars},
+	}
+	for _, tc := range tests {
+		soln := solver.New(es, nil).SolveInOrder(tc.cap)
+		var sold int
+		for _, e := range soln {
+			sold += e.N
+		}
+		if _, gain := totals(soln); sold != tc.sold || gain != tc.gains {
+			t.Errorf("SolveInOrder(%v): sold %d shares with gain %v, want %d with gain %v", tc.cap, sold, gain, tc.sold, tc.gains)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	// ids returns the IDs of the entries of soln, with the shares sold of each.
+	ids := func(soln []solver.Entry) map[any]int {
+		out := make(map[any]int)
+		for _, e := range soln {
+			out[e.ID] = e.N
+		}
+		return out
+	}
+	tests := []struct {
+		name       string
+		es         []solver.Entry
+		cap        currency.Value
+		plain, cmp map[any]int // the plans without and with Compact
+	}{
+		// Each case has several plans of equal value, and without Compact the
+		// table keeps one that Compact does not.
+		{"FewerShares", []solver.Entry{
+			{ID: "small", N: 4, Value: 5 * currency.Dollars, Gain: 2 * currency.Dollars},
+			{ID: "mid", N: 2, Value: 10 * currency.Dollars, Gain: 4 * currency.Dollars},
+			{ID: "big", N: 1, Value: 20 * currency.Dollars, Gain: 8 * currency.Dollars},
+		}, 8 * currency.Dollars, map[any]int{"small": 4}, map[any]int{"big": 1}},
+
+		{"FewerLots", []solver.Entry{
+			{ID: "c", N: 2, Value: 10 * currency.Dollars, Gain: 4 * currency.Dollars},
+			{ID: "a", N: 1, Value: 10 * currency.Dollars, Gain: 4 * currency.Dollars},
+			{ID: "b", N: 1, Value: 10 * currency.Dollars, Gain: 4 * currency.Dollars},
+		}, 8 * currency.Dollars, map[any]int{"a": 1, "b": 1}, map[any]int{"c": 2}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, compact := range []bool{false, true} {
+				want := tc.plain
+				if compact {
+					want = tc.cmp
+				}
+				soln, _ := solver.New(tc.es, &solver.Options{Compact: compact}).Solve(tc.cap)
+				if got := ids(soln); !maps.Equal(got, want) {
+					t.Errorf("Solve(%v) with Compact=%v: got plan %v, want %v", tc.cap, compact, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	// The table finds a plan worth $27, selling a share of a with a lower
+	// value per unit of gain, but three shares of b and c are worth $30
+	// within the cap. The exact search finds them and proves them optimal.
+	es := []solver.Entry{
+		{ID: "a", N: 2, Value: 7 * currency.Dollars, Gain: 6 * currency.Dollars},
+		{ID: "b", N: 3, Value: 10 * currency.Dollars, Gain: 7 * currency.Dollars},
+		{ID: "c", N: 2, Value: 10 * currency.Dollars, Gain: 7 * currency.Dollars},
+	}
+	cap := currency.Value(25 * currency.Dollars)
+	soln, diag := solver.New(es, nil).Solve(cap)
+	want := currency.Value(30 * currency.Dollars)
+	if value, gain := totals(soln); value != want || gain > cap {
+		t.Errorf("Solve(%v): got value %v gain %v, want value %v", cap, value, gain, want)
+	}
+	if !diag.Optimal || diag.Aborted || diag.Nodes == 0 {
+		t.Errorf("Solve(%v): diagnostics %+v, want a finished optimal search", cap, diag)
+	}
+	if diag.Objective != want || diag.Bound != want || diag.Gap() != 0 {
+		t.Errorf("Solve(%v): objective %v bound %v gap %v, want %v, %v, 0",
+			cap, diag.Objective, diag.Bound, diag.Gap(), want, want)
+	}
+}
+
+func TestSolveForProceeds(t *testing.T) {
+	d := func(v float64) currency.Value { return currency.Value(v * float64(currency.Dollars)) }
+	es := []solver.Entry{
+		{ID: "a", N: 1, Value: d(99), Gain: 0},
+		{ID: "b", N: 1, Value: d(1000), Gain: d(250)},
+		{ID: "c", N: 10, Value: d(2), Gain: d(0.60)},
+	}
+	tests := []struct {
+		name   string
+		opts   *solver.Options
+		target currency.Value
+		gain   currency.Value
+	}{
+		{"Small", nil, d(100), d(0.60)},
+		{"Ratio", &solver.Options{MaxGainRatio: 0.1}, d(100), d(0.60)},
+		{"Large", nil, d(1100), d(250.60)},
+		{"TightRatio", &solver.Options{MaxGainRatio: 0.25}, d(1100), d(250.60)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			soln := solver.New(es, tc.opts).SolveForProceeds(tc.target)
+			if soln == nil {
+				t.Fatalf("SolveForProceeds(%v): no plan", tc.target)
+			}
+			value, gain := totals(soln)
+			if value < tc.target || gain != tc.gain {
+				t.Errorf("SolveForProceeds(%v): got value %v gain %v, want gain %v", tc.target, value, gain, tc.gain)
+			}
+		})
+	}
+	t.Run("NoRatio", func(t *testing.T) {
+		opts := &solver.Options{MaxGainRatio: 0.2}
+		if soln := solver.New(es, opts).SolveForProceeds(d(1100)); soln != nil {
+			t.Errorf("SolveForProceeds: got %+v, want nil", soln)
+		}
+	})
+	t.Run("RatioMany", func(t *testing.T) {
+		// With more than ExactLimit entries the greedy plan, a and b, is over
+		// the ratio, but searching finds a and one share of c.
+		many := append([]solver.Entry(nil), es...)
+		for i := range solver.ExactLimit {
+			many = append(many, solver.Entry{ID: i, N: 1, Value: d(1), Gain: d(0.90)})
+		}
+		soln := solver.New(many, &solver.Options{MaxGainRatio: 0.1}).SolveForProceeds(d(100))
+		if value, gain := totals(soln); value < d(100) || gain > value/10 {
+			t.Errorf("SolveForProceeds: got value %v gain %v, want gain within 10%% of at least $100", value, gain)
+		}
+	})
+}
+
+// A score is the objective of a plan for SolveForProceeds: its total gain,
+// then the number of lots and shares it sells, each lower being better.
+type score struct {
+	gain         currency.Value
+	lots, shares int
+}
+
+func (a score) less(b score) bool {
+	if a.gain != b.gain {
+		return a.gain < b.gain
+	} else if a.lots != b.lots {
+		return a.lots < b.lots
+	}
+	return a.shares < b.shares
+}
+
+func scoreOf(soln []solver.Entry) score {
+	var sc score
+	for _, e := range soln {
+		if e.N > 0 {
+			sc.gain += e.Gain * currency.Value(e.N)
+			sc.shares += e.N
+			sc.lots++
+		}
+	}
+	return sc
+}
+
+// bruteProceeds returns the score of the best plan raising target from es
+// under opts, found by enumerating every plan, and whether there is one.
+func bruteProceeds(es []solver.Entry, opts *solver.Options, target currency.Value) (score, bool) {
+	var best score
+	var found bool
+	take := make([]int, len(es))
+	var visit func(i int)
+	visit = func(i int) {
+		if i < len(es) {
+			for n := 0; n <= es[i].N; n++ {
+				take[i] = n
+				visit(i + 1)
+			}
+			return
+		}
+		var value currency.Value
+		var sc score
+		for k, n := range take {
+			value += es[k].Value * currency.Value(n)
+			sc.gain += es[k].Gain * currency.Value(n)
+			sc.shares += n
+			if n > 0 {
+				sc.lots++
+			}
+		}
+		if value < target || (opts.ForbidNetLoss && sc.gain < 0) {
+			return
+		} else if r := opts.MaxGainRatio; r > 0 && float64(sc.gain) > r*float64(value) {
+			return
+		}
+		if !found || sc.less(best) {
+			best, found = sc, true
+		}
+	}
+	visit(0)
+	return best, found
+}
+
+// randomEntries returns n entries of at most maxShares shares each, with
+// values and gains (some of them losses) in whole dollars.
+func randomEntries(r *rand.Rand, n, maxShares int) []solver.Entry {
+	es := make([]solver.Entry, n)
+	for i := range es {
+		es[i] = solver.Entry{
+			ID:    i,
+			N:     1 + r.IntN(maxShares),
+			Value: currency.Value(1+r.IntN(50)) * currency.Dollars,
+			Gain:  currency.Value(r.IntN(40)-8) * currency.Dollars,
+		}
+	}
+	return es
+}
+
+func TestSolveForProceedsParity(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := range 300 {
+		es := randomEntries(r, 1+r.IntN(5), 4)
+		opts := &solver.Options{ForbidNetLoss: i%3 == 1}
+		if i%2 == 1 {
+			opts.MaxGainRatio = 0.1 + 0.1*float64(r.IntN(5))
+		}
+		var total currency.Value
+		for _, e := range es {
+			total += e.Value * currency.Value(e.N)
+		}
+		target := currency.Value(1+r.Int64N(int64(total/currency.Dollars))) * currency.Dollars
+
+		want, ok := bruteProceeds(es, opts, target)
+		soln := solver.New(es, opts).SolveForProceeds(target)
+		if !ok {
+			if soln != nil {
+				t.Errorf("Case %d: got plan %+v, want nil", i, soln)
+			}
+			continue
+		} else if soln == nil {
+			t.Errorf("Case %d: got no plan, want %+v", i, want)
+			continue
+		}
+		if value, _ := totals(soln); value < target {
+			t.Errorf("Case %d: plan raises %v, want at least %v", i, value, target)
+		}
+		if got := scoreOf(soln); got != want {
+			t.Errorf("Case %d: got %+v, want %+v\nentries: %+v\ntarget: %v, opts: %+v", i, got, want, es, target, *opts)
+		}
+	}
+}
+
+// An outcome is the objective of a plan for Solve: its total value (net of
+// tax, with AfterTax), then with Compact the number of shares and lots it
+// sells, fewer being better.
+type outcome struct {
+	value        currency.Value
+	shares, lots int
+}
+
+func (a outcome) better(b outcome) bool {
+	if a.value != b.value {
+		return a.value > b.value
+	} else if a.shares != b.shares {
+		return a.shares < b.shares
+	}
+	return a.lots < b.lots
+}
+
+// bruteSolve returns the outcome of the best plan from es under cap and opts,
+// found by enumerating every plan.
+func bruteSolve(es []solver.Entry, opts *solver.Options, cap currency.Value) (best outcome) {
+	found := false
+	take := make([]int, len(es))
+	var visit func(i int)
+	visit = func(i int) {
+		if i < len(es) {
+			for n := 0; n <= es[i].N; n++ {
+				if n > 0 && opts.ExcludeLosses && es[i].Gain < 0 {
+					break
+				}
+				take[i] = n
+				visit(i + 1)
+			}
+			return
+		}
+		var soln []solver.Entry
+		for k, n := range take {
+			soln = append(soln, es[k])
+			soln[k].N = n
+		}
+		if !feasible(soln, opts, cap) {
+			return
+		}
+		if oc := objective(soln, opts); !found || oc.better(best) {
+			best, found = oc, true
+		}
+	}
+	visit(0)
+	return best
+}
+
+// feasible reports whether soln respects cap and the constraints of opts.
+func feasible(soln []solver.Entry, opts *solver.Options, cap currency.Value) bool {
+	_, gain := totals(soln)
+	if gain > cap || (opts.ForbidNetLoss && gain < 0) {
+		return false
+	}
+	for _, lim := range opts.Limits {
+		var lg currency.Value
+		for _, e := range soln {
+			if lim.Applies(e) {
+				lg += e.Gain * currency.Value(e.N)
+			}
+		}
+		if lg > lim.Cap {
+			return false
+		}
+	}
+	return true
+}
+
+// objective returns the outcome of soln under opts.
+func objective(soln []solver.Entry, opts *solver.Options) outcome {
+	var oc outcome
+	for _, e := range soln {
+		v := e.Value
+		if opts.AfterTax {
+			v -= e.Gain.Percent(e.TaxRate)
+		}
+		oc.value += v * currency.Value(e.N)
+		if opts.Compact && e.N > 0 {
+			oc.shares += e.N
+			oc.lots++
+		}
+	}
+	return oc
+}
+
+func TestSolveParity(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	for i := range 400 {
+		es := randomEntries(r, 1+r.IntN(5), 4)
+		for k := range es {
+			es[k].LongTerm = r.IntN(2) == 0
+			es[k].TaxRate = float64(10 * r.IntN(4))
+		}
+		opts := &solver.Options{
+			Compact:       i%2 == 1,
+			ExcludeLosses: i%5 == 1,
+			ForbidNetLoss: i%3 == 1,
+			AfterTax:      i%7 == 1,
+		}
+		if i%4 == 1 {
+			opts.Limits = []solver.Limit{{
+				Name:    "short-term",
+				Cap:     currency.Value(r.IntN(40)) * currency.Dollars,
+				Applies: func(e solver.Entry) bool { return !e.LongTerm },
+			}}
+		}
+		if i%6 == 1 {
+			// A limit that overlaps the short-term limit without nesting.
+			opts.Limits = append(opts.Limits, solver.Limit{
+				Name:    "even",
+				Cap:     currency.Value(r.IntN(40)) * currency.Dollars,
+				Applies: func(e solver.Entry) bool { return e.ID.(int)%2 == 0 },
+			})
+		}
+		cap := currency.Value(r.IntN(120)) * currency.Dollars
+
+		want := bruteSolve(es, opts, cap)
+		soln, diag := solver.New(es, opts).Solve(cap)
+		if !feasible(soln, opts, cap) {
+			t.Errorf("Case %d: plan %+v is not feasible", i, soln)
+		} else if got := objective(soln, opts); got != want {
+			t.Errorf("Case %d: got %+v, want %+v\nentries: %+v\ncap: %v, opts: %+v", i, got, want, es, cap, *opts)
+		}
+		if !diag.Optimal {
+			t.Errorf("Case %d: diagnostics %+v do not report an optimal plan", i, diag)
+		}
+	}
+}
+
+// portfolio returns n entries of a few hundred shares each, for benchmarks.
+func portfolio(n int) []solver.Entry {
+	r := rand.New(rand.NewPCG(5, 6))
+	es := make([]solver.Entry, n)
+	for i := range es {
+		value := currency.Value(100+r.IntN(100)) * currency.Dollars
+		es[i] = solver.Entry{
+			ID:       i,
+			N:        100 + r.IntN(400),
+			Value:    value,
+			Gain:     value - currency.Value(40+r.IntN(150))*currency.Dollars + currency.Value(r.IntN(100))*currency.Cents,
+			LongTerm: i%3 != 0,
+		}
+	}
+	return es
+}
+
+func BenchmarkSolve(b *testing.B) {
+	es := portfolio(50)
+	cap := currency.Value(250000 * currency.Dollars)
+	run := func(opts *solver.Options) func(b *testing.B) {
+		return func(b *testing.B) {
+			b.ReportAllocs()
+			var diag solver.Diagnostics
+			for range b.N {
+				_, diag = solver.New(es, opts).Solve(cap)
+			}
+			if !diag.Optimal {
+				b.Errorf("Plan is not optimal: diagnostics %+v", diag)
+			}
+		}
+	}
+	b.Run("NoLimits", run(nil))
+	b.Run("Limits", run(&solver.Options{
+		Limits: []solver.Limit{{
+			Name:    "short-term",
+			Cap:     currency.Value(20000 * currency.Dollars),
+			Applies: func(e solver.Entry) bool { return !e.LongTerm },
+		}},
+	}))
+}
@@ -0,0 +1,40 @@
+package solver
+
+import "github.com/creachadair/stockopt/currency"
+
+// A YearBudget describes the sales permitted in one year of a multi-year plan.
+type YearBudget struct {
+	Cap currency.Value // the gains cap for the year
+
+	// If not nil, reports whether an entry may be sold in the year, for
+	// example because its shares have been held long enough by then.
+	Eligible func(Entry) bool
+}
+
+func (y YearBudget) eligible(e Entry) bool { return y.Eligible == nil || y.Eligible(e) }
+
+// PlanYears returns a sale plan for each of the given years, in order. Each
+// year's plan is the solution, under that year's cap, for the shares eligible
+// that year and not sold in a previous year. The options apply to each year
+// separately. Entry IDs must be comparable.
+//
+// The plan is greedy by year: each year sells the most value it can without
+// regard for later years, so it does not defer sales to a year in which they
+// would be more valuable.
+func PlanYears(es []Entry, years []YearBudget, opts *Options) [][]Entry {
+	sold := make(map[interface{}]int)
+	plans := make([][]Entry, len(years))
+	for y, budget := range years {
+		var avail []Entry
+		for _, e := range es {
+			if n := e.N - sold[e.ID]; n > 0 && budget.eligible(e) {
+				avail = append(avail, e.take(n))
+			}
+		}
+		plans[y], _ = New(avail, opts).Solve(budget.Cap)
+		for _, e := range plans[y] {
+			sold[e.ID] += e.N
+		}
+	}
+	return plans
+}
@@ -0,0 +1,260 @@
+package statement
+
+import (
+	"bytes"
+	"math"
+	"strings"
+)
+
+// A Format parses the statements exported by one brokerage. All formats
+// produce the same entries, so that callers need not know the source of a
+// statement.
+type Format interface {
+	// Name returns the name of the format, e.g., "mssb".
+	Name() string
+
+	// Detect reports whether data appear to be a statement in this format.
+	Detect(data []byte) bool
+
+	// Parse extracts the entries from the statement in data, returning those
+	// matched by the options (or all if opts == nil), along with the metadata
+	// stated in the header of the report.
+	Parse(data []byte, opts *Options) ([]*Entry, *Meta, error)
+}
+
+// The supported statement formats.
+var (
+	// MSSB is the Gain/Loss report of the MSSB stock plan site, as .xls,
+	// .xlsx, or CSV.
+	MSSB Format = mssbFormat{}
+
+	// Schwab is the Equity Awards lot details CSV export of Charles Schwab.
+	Schwab Format = &brokerFormat{
+		name: "schwab",
+		plan: "Schwab",
+		columns: map[string][]string{
+			acquiredDate:    {"vest date", "acquired date", "date acquired"},
+			planName:        {"award type", "plan"},
+			acquiredPrice:   {"vest fmv", "cost basis per share", "cost basis/share"},
+			acquiredVia:     {"award id", "grant id"},
+			sharesAvailable: {"available shares", "shares available", "quantity"},
+			currentValue:    {"market value", "current value"},
+			totalGainLoss:   {"gain/loss", "unrealized gain/loss", "gain/loss $"},
+			symbolName:      {"symbol"},
+		},
+	}
+
+	// ETrade is the E*TRADE Gains & Losses CSV export, by lot.
+	ETrade Format = &brokerFormat{
+		name: "etrade",
+		plan: "E*TRADE",
+		columns: map[string][]string{
+			acquiredDate:    {"date acquired"},
+			planName:        {"plan type"},
+			acquiredPrice:   {"adjusted cost basis per share", "cost basis per share"},
+			acquiredVia:     {"grant number", "order type"},
+			sharesAvailable: {"sellable qty.", "sellable qty", "quantity"},
+			currentValue:    {"est. market value", "market value"},
+			totalGainLoss:   {"adjusted gain/loss", "est. gain/loss", "gain/loss"},
+			symbolName:      {"symbol"},
+		},
+	}
+
+	// Fidelity is the lot detail CSV export of a Fidelity position.
+	Fidelity Format = &brokerFormat{
+		name: "fidelity",
+		plan: "Fidelity",
+		columns: map[string][]string{
+			acquiredDate:    {"acquired", "date acquired"},
+			planName:        {"account name", "account"},
+			acquiredPrice:   {"cost basis/share", "cost basis per share"},
+			sharesAvailable: {"quantity"},
+			currentValue:    {"current value"},
+			totalGainLoss:   {"total gain/loss dollar", "total gain/loss $", "gain/loss"},
+			symbolName:      {"symbol"},
+		},
+	}
+
+	// Formats lists the supported formats, in the order DetectFormat prefers
+	// them.
+	Formats = []Format{MSSB, Schwab, ETrade, Fidelity}
+)
+
+// LookupFormat returns the format with the given name, ignoring case, or nil
+// if there is no such format.
+func LookupFormat(name string) Format {
+	for _, f := range Formats {
+		if strings.EqualFold(f.Name(), name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// DetectFormat returns the format of Formats that best matches data. Several
+// formats may detect the same data, since brokerages share column names, so
+// the format recognizing the most columns of the header of the statement is
+// chosen, and among those the first. If no format detects data, DetectFormat
+// returns MSSB.
+func DetectFormat(data []byte) Format {
+	out, best := MSSB, 0
+	for _, f := range Formats {
+		var n int
+		if s, ok := f.(scorer); ok {
+			n = s.score(data)
+		} else if f.Detect(data) {
+			n = 1
+		}
+		if n > best {
+			out, best = f, n
+		}
+	}
+	return out
+}
+
+// A scorer is a Format that reports how closely data match it.
+type scorer interface {
+	// score returns the number of columns of the header of the statement in
+	// data that the format recognizes, or 0 if it does not detect data.
+	score(data []byte) int
+}
+
+type mssbFormat struct{}
+
+func (mssbFormat) Name() string { return "mssb" }
+
+func (m mssbFormat) Detect(data []byte) bool { return m.score(data) > 0 }
+
+// score reports a workbook as matching every column, since only the MSSB
+// format reads workbooks.
+func (mssbFormat) score(data []byte) int {
+	if bytes.HasPrefix(data, ole2Magic) || bytes.HasPrefix(data, zipMagic) {
+		return math.MaxInt
+	}
+	rows, err := readCSV(data)
+	if err != nil {
+		return 0
+	} else if i := findHeader(rows); i >= 0 {
+		return len(rows[i])
+	}
+	return 0
+}
+
+func (mssbFormat) Parse(data []byte, opts *Options) ([]*Entry, *Meta, error) {
+	return parseMSSB(data, opts)
+}
+
+// A brokerFormat is a CSV statement format whose columns carry the same
+// information as those of the MSSB report under other names. Columns not
+// named in the format are ignored. As in the MSSB report, the acquired price
+// is per share, and the market value and gain are totals for the lot.
+//
+// A row is skipped if its acquired date is empty or its first cell begins with
+// "Total", as brokerages often end a table with rows of totals.
+type brokerFormat struct {
+	name string
+
+	// The names of the columns holding the values of each MSSB column, in
+	// lower case. The plan name, acquired via, and symbol columns are optional;
+	// if there is no plan name column, plan is used as the plan of all entries.
+	columns map[string][]string
+	plan    string
+}
+
+func (b *brokerFormat) Name() string { return b.name }
+
+func (b *brokerFormat) Detect(data []byte) bool { return b.score(data) > 0 }
+
+func (b *brokerFormat) score(data []byte) int {
+	rows, err := readCSV(data)
+	if err != nil {
+		return 0
+	}
+	_, pos := b.findHeader(rows)
+	return len(pos)
+}
+
+func (b *brokerFormat) Parse(data []byte, opts *Options) ([]*Entry, *Meta, error) {
+	rows, err := readCSV(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	i, pos := b.findHeader(rows)
+	if pos == nil {
+		return nil, nil, errNoHeader
+	}
+
+	// Translate the rows into the columns of the MSSB report, so that they
+	// are parsed the same way.
+	names := []string{acquiredDate, planName, acquiredPrice, acquiredVia,
+		sharesAvailable, currentValue, totalGainLoss}
+	if _, ok := pos[symbolName]; ok {
+		names = append(names, symbolName)
+	}
+	out := append([][]string(nil), rows[:i]...)
+	out = append(out, names)
+	for _, row := range rows[i+1:] {
+		cell := func(name string) string {
+			if p, ok := pos[name]; ok && p < len(row) {
+				return strings.TrimSpace(row[p])
+			}
+			return ""
+		}
+		if cell(acquiredDate) == "" ||
+			(len(row) != 0 && strings.HasPrefix(strings.ToLower(strings.TrimSpace(row[0])), "total")) {
+			continue
+		}
+		tr := make([]string, len(names))
+		for j, name := range names {
+			tr[j] = cell(name)
+		}
+		if _, ok := pos[planName]; !ok {
+			tr[1] = b.plan
+		}
+		tr[4] = wholeShares(tr[4])
+		out = append(out, tr)
+	}
+	return parseEntries(out, opts)
+}
+
+// findHeader returns the index of the header row of rows, and the positions
+// in that row of the columns of the format, keyed by MSSB column name. It
+// returns nil positions if there is no header row.
+func (b *brokerFormat) findHeader(rows [][]string) (int, map[string]int) {
+	for i, row := range rows {
+		pos := make(map[string]int)
+		for j, cell := range row {
+			key := strings.ToLower(strings.TrimSpace(cell))
+			for name, alts := range b.columns {
+				if _, ok := pos[name]; ok {
+					continue
+				}
+				for _, alt := range alts {
+					if key == alt {
+						pos[name] = j
+					}
+				}
+			}
+		}
+		missing := false
+		for _, name := range []string{acquiredDate, acquiredPrice, sharesAvailable, currentValue, totalGainLoss} {
+			if _, ok := pos[name]; !ok {
+				missing = true
+			}
+		}
+		if !missing {
+			return i, pos
+		}
+	}
+	return -1, nil
+}
+
+// wholeShares removes grouping commas and a zero fractional part from a share
+// count, as in "1,000.000".
+func wholeShares(s string) string {
+	s = strings.ReplaceAll(s, ",", "")
+	if i := strings.Index(s, "."); i >= 0 && strings.Trim(s[i+1:], "0") == "" {
+		s = s[:i]
+	}
+	return s
+}
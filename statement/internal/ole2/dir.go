@@ -0,0 +1,41 @@
+package ole2
+
+import (
+	"unicode/utf16"
+)
+
+const (
+	EMPTY       = iota
+	USERSTORAGE = iota
+	USERSTREAM  = iota
+	LOCKBYTES   = iota
+	PROPERTY    = iota
+	ROOT        = iota
+)
+
+type File struct {
+	NameBts   [32]uint16
+	Bsize     uint16
+	Type      byte
+	Flag      byte
+	Left      uint32
+	Right     uint32
+	Child     uint32
+	Guid      [8]uint16
+	Userflags uint32
+	Time      [2]uint64
+	Sstart    uint32
+	Size      uint32
+	Proptype  uint32
+}
+
+func (d *File) Name() string {
+	// The size includes the terminating NUL, and is corrupt if it is not
+	// within the name.
+	n := int(d.Bsize/2) - 1
+	if n < 0 || n > len(d.NameBts) {
+		return ""
+	}
+	runes := utf16.Decode(d.NameBts[:n])
+	return string(runes)
+}
@@ -0,0 +1,189 @@
+package ole2
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var ENDOFCHAIN = uint32(0xFFFFFFFE) //-2
+var FREESECT = uint32(0xFFFFFFFF)   // -1
+
+// ErrCorrupt is reported for a file whose allocation tables are inconsistent
+// with its size, or whose sector chains run into a cycle or off the end of
+// their allocation table.
+var ErrCorrupt = errors.New("corrupt compound file")
+
+type Ole struct {
+	header   *Header
+	Lsector  uint32
+	Lssector uint32
+	SecID    []uint32
+	SSecID   []uint32
+	Files    []File
+	reader   io.ReadSeeker
+	nsec     uint32 // the number of sectors following the header
+}
+
+func Open(reader io.ReadSeeker, charset string) (ole *Ole, err error) {
+	var header *Header
+	var hbts = make([]byte, 512)
+	size, err := reader.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	} else if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader.Read(hbts)
+	if header, err = parseHeader(hbts); err == nil {
+		ole = new(Ole)
+		ole.reader = reader
+		ole.header = header
+		ole.Lsector = 512 //TODO
+		ole.Lssector = 64 //TODO
+		if size > 512 {
+			ole.nsec = uint32(min((size-1)/512, 1<<32-1))
+		}
+		err = ole.readMSAT()
+		return ole, err
+	}
+
+	return nil, err
+}
+
+func (o *Ole) ListDir() (dir []*File, err error) {
+	sector := o.stream_read(o.header.Dirstart, 0)
+	dir = make([]*File, 0)
+	for {
+		d := new(File)
+		err = binary.Read(sector, binary.LittleEndian, d)
+		if err == nil && d.Type != EMPTY {
+			dir = append(dir, d)
+		} else {
+			break
+		}
+	}
+	if err == io.EOF && dir != nil {
+		return dir, nil
+	}
+
+	return
+}
+
+func (o *Ole) OpenFile(file *File, root *File) io.ReadSeeker {
+	if file.Size < o.header.Sectorcutoff {
+		// Without a root entry, there is no short-sector stream.
+		rootStart := ENDOFCHAIN
+		if root != nil {
+			rootStart = root.Sstart
+		}
+		return o.short_stream_read(file.Sstart, file.Size, rootStart)
+	} else {
+		return o.stream_read(file.Sstart, file.Size)
+	}
+}
+
+// Read MSAT
+//
+// The allocation tables cannot have more sectors than the file, and only as
+// many sectors of the sector allocation table are read as the header gives,
+// so that free entries of the master table are not read as sectors. The
+// chain of the short-sector allocation table is followed through the sector
+// allocation table.
+func (o *Ole) readMSAT() error {
+	if o.header.Cfat > o.nsec || o.header.Csfat > o.nsec || o.header.Cdif > o.nsec {
+		return ErrCorrupt
+	}
+	remain := o.header.Cfat
+
+	for i := 0; i < 109 && remain > 0; i++ {
+		if sector, err := o.sector_read(o.header.Msat[i]); err == nil {
+			sids := sector.AllValues(o.Lsector)
+			o.SecID = append(o.SecID, sids...)
+			remain--
+		} else {
+			return err
+		}
+	}
+
+	for sid := o.header.Difstart; sid != ENDOFCHAIN && remain > 0; {
+		if sector, err := o.sector_read(sid); err == nil {
+			sids := sector.MsatValues(o.Lsector)
+
+			for _, sid := range sids {
+				if remain == 0 {
+					break
+				}
+				if sector, err := o.sector_read(sid); err == nil {
+					sids := sector.AllValues(o.Lsector)
+
+					o.SecID = append(o.SecID, sids...)
+					remain--
+				} else {
+					return err
+				}
+			}
+
+			sid = sector.NextSid(o.Lsector)
+		} else {
+			return err
+		}
+	}
+
+	sid := o.header.Sfatstart
+	for i := uint32(0); i < o.header.Csfat && sid != ENDOFCHAIN; i++ {
+		if sector, err := o.sector_read(sid); err == nil {
+			sids := sector.AllValues(o.Lsector)
+
+			o.SSecID = append(o.SSecID, sids...)
+
+			if sid >= uint32(len(o.SecID)) {
+				return ErrCorrupt
+			}
+			sid = o.SecID[sid]
+		} else {
+			return err
+		}
+	}
+	return nil
+
+}
+
+// A chain of sectors within the file has at most as many sectors as the file,
+// and each sector holds Lsector/Lssector short sectors, so the readers stop at
+// a longer chain, which has a cycle.
+func (o *Ole) stream_read(sid uint32, size uint32) *StreamReader {
+	return &StreamReader{o.SecID, sid, o.reader, sid, 0, o.Lsector, int64(size), 0, sector_pos, 0, int(o.nsec), nil}
+}
+
+func (o *Ole) short_stream_read(sid uint32, size uint32, startSecId uint32) *StreamReader {
+	ssatReader := &StreamReader{o.SecID, startSecId, o.reader, sid, 0, o.Lsector, int64(uint32(len(o.SSecID)) * o.Lssector), 0, sector_pos, 0, int(o.nsec), nil}
+	return &StreamReader{o.SSecID, sid, ssatReader, sid, 0, o.Lssector, int64(size), 0, short_sector_pos, 0, int(o.nsec * (o.Lsector / o.Lssector)), nil}
+}
+
+func (o *Ole) sector_read(sid uint32) (Sector, error) {
+	return o.sector_read_internal(sid, o.Lsector)
+}
+
+func (o *Ole) short_sector_read(sid uint32) (Sector, error) {
+	return o.sector_read_internal(sid, o.Lssector)
+}
+
+func (o *Ole) sector_read_internal(sid, size uint32) (Sector, error) {
+	pos := sector_pos(sid, size)
+	if _, err := o.reader.Seek(int64(pos), 0); err == nil {
+		var bts = make([]byte, size)
+		o.reader.Read(bts)
+		return Sector(bts), nil
+	} else {
+		return nil, err
+	}
+}
+
+func sector_pos(sid uint32, size uint32) uint32 {
+	return 512 + sid*size
+}
+
+func short_sector_pos(sid uint32, size uint32) uint32 {
+	return sid * size
+}
@@ -0,0 +1,42 @@
+package xls
+
+import (
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+)
+
+// the information unit in xls file
+type bof struct {
+	Id   uint16
+	Size uint16
+}
+
+// read the utf16 string from reader
+//
+// The string has count characters, including a terminating NUL, or as many as
+// the reader has if fewer; the count is not trusted to allocate them.
+func (b *bof) utf16String(buf io.ReadSeeker, count uint32) string {
+	var bts []uint16
+	for i := uint32(0); i < count; i++ {
+		var c uint16
+		if binary.Read(buf, binary.LittleEndian, &c) != nil {
+			break
+		}
+		bts = append(bts, c)
+	}
+	if len(bts) == 0 {
+		return ""
+	}
+	runes := utf16.Decode(bts[:len(bts)-1])
+	return string(runes)
+}
+
+type biffHeader struct {
+	Ver     uint16
+	Type    uint16
+	Id_make uint16
+	Year    uint16
+	Flags   uint32
+	Min_ver uint32
+}
@@ -0,0 +1,6 @@
+package xls
+
+type SstInfo struct {
+	Total uint32
+	Count uint32
+}
@@ -0,0 +1,85 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Period is a calendar interval measured in years, months, and days.
+// A *Period satisfies the flag.Value interface.
+type Period struct {
+	Years, Months, Days int
+}
+
+// ParsePeriod parses a period written as a sequence of counts with units y
+// (years), m (months), and d (days), for example "2y", "18m", or "1y6m".
+func ParsePeriod(s string) (Period, error) {
+	var p Period
+	rest := strings.TrimSpace(s)
+	if rest == "" {
+		return p, errors.New("empty period")
+	}
+	for rest != "" {
+		i := strings.IndexAny(rest, "ymd")
+		if i <= 0 {
+			return Period{}, fmt.Errorf("invalid period %q", s)
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil || n < 0 {
+			return Period{}, fmt.Errorf("invalid period %q", s)
+		}
+		switch rest[i] {
+		case 'y':
+			p.Years += n
+		case 'm':
+			p.Months += n
+		case 'd':
+			p.Days += n
+		}
+		rest = rest[i+1:]
+	}
+	return p, nil
+}
+
+// AddTo returns the time p after t.
+func (p Period) AddTo(t time.Time) time.Time { return t.AddDate(p.Years, p.Months, p.Days) }
+
+// HeldPast returns the first date on which something acquired at t has been
+// held for more than p. If p ends past the last day of a month, as one year
+// after a leap day does, the period ends on the last day of that month.
+func (p Period) HeldPast(t time.Time) time.Time {
+	end := t.AddDate(p.Years, p.Months, 0)
+	if end.Day() != t.Day() {
+		end = end.AddDate(0, 0, -end.Day())
+	}
+	return end.AddDate(0, 0, p.Days+1)
+}
+
+// String renders p in the format accepted by ParsePeriod.
+func (p Period) String() string {
+	var sb strings.Builder
+	for _, u := range []struct {
+		n    int
+		unit string
+	}{{p.Years, "y"}, {p.Months, "m"}, {p.Days, "d"}} {
+		if u.n != 0 {
+			fmt.Fprintf(&sb, "%d%s", u.n, u.unit)
+		}
+	}
+	if sb.Len() == 0 {
+		return "0d"
+	}
+	return sb.String()
+}
+
+// Set implements part of the flag.Value interface.
+func (p *Period) Set(s string) error {
+	v, err := ParsePeriod(s)
+	if err == nil {
+		*p = v
+	}
+	return err
+}
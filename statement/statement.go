@@ -1,20 +1,21 @@
-// Package statement parses stock gain/loss statements as issued by MSSB.
+// Package statement parses stock gain/loss statements as issued by MSSB and
+// other brokerages.
 package statement
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
-	"math"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/creachadair/stockopt/currency"
-	"github.com/extrame/xls"
+	"github.com/creachadair/stockopt/statement/internal/xls"
 )
 
 // Options control the behaviour of a parser.
@@ -25,6 +26,23 @@ type Options struct {
 
 	// If set, override the current market value per share.
 	MarketPrice currency.Value
+
+	// The holding period after which a sale is long-term: shares must be held
+	// for more than this period. If zero, DefaultLongTerm is used.
+	LongTerm Period
+}
+
+// DefaultLongTerm is the default long-term holding period. Under the U.S. rule,
+// a sale is long-term if the shares were held for more than one year, that is,
+// if they are sold on or after the day following the first anniversary of
+// their acquisition.
+var DefaultLongTerm = Period{Years: 1}
+
+func (o *Options) longTerm() Period {
+	if o == nil || o.LongTerm == (Period{}) {
+		return DefaultLongTerm
+	}
+	return o.LongTerm
 }
 
 func (o *Options) filter() func(*Entry) bool {
@@ -42,62 +60,178 @@ func (o *Options) fixPrice(e *Entry) *Entry {
 	return e
 }
 
+// Meta records descriptive information from the header region of a statement,
+// preceding the table of entries.
+type Meta struct {
+	Currency string    // currency code of amounts (default "USD")
+	Symbol   string    // symbol of the security, if stated
+	AsOf     time.Time // the date of the statement, if stated
+}
+
+// metaLabels maps header labels to functions recording their values.
+var metaLabels = map[string]func(string, *Meta){
+	"currency":      func(s string, m *Meta) { m.Currency = strings.ToUpper(s) },
+	"symbol":        func(s string, m *Meta) { m.Symbol = s },
+	"ticker":        func(s string, m *Meta) { m.Symbol = s },
+	"ticker symbol": func(s string, m *Meta) { m.Symbol = s },
+	"as of":         setAsOf,
+	"as of date":    setAsOf,
+	"report date":   setAsOf,
+}
+
+func setAsOf(s string, m *Meta) {
+	if t, err := parseDate(s); err == nil {
+		m.AsOf = t
+	}
+}
+
+// parseMeta extracts metadata from the rows preceding the header. A label may
+// be followed by its value in the next non-empty cell of the same row, or
+// share a cell with it separated by a colon ("Symbol: GOOG"). The date of the
+// statement may also be written as "As of mm/dd/yyyy".
+func parseMeta(rows [][]string) *Meta {
+	meta := new(Meta)
+	for _, row := range rows {
+		for i, cell := range row {
+			label, value, ok := strings.Cut(cell, ":")
+			if !ok && strings.HasPrefix(strings.ToLower(strings.TrimSpace(cell)), "as of ") {
+				label, value, ok = "as of", strings.TrimSpace(cell)[len("as of "):], true
+			}
+			set, known := metaLabels[strings.ToLower(strings.TrimSpace(label))]
+			if !known {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if !ok || value == "" {
+				for _, next := range row[i+1:] {
+					if value = strings.TrimSpace(next); value != "" {
+						break
+					}
+				}
+			}
+			if value != "" {
+				set(value, meta)
+			}
+		}
+	}
+	return meta
+}
+
+// Parse extracts the gain/loss entries from the statement in data, returning
+// those matched by the options (or all if opts == nil), along with the
+// metadata stated in the header of the report. The format of the statement is
+// detected from its content by DetectFormat.
+func Parse(data []byte, opts *Options) ([]*Entry, *Meta, error) {
+	return DetectFormat(data).Parse(data, opts)
+}
+
+// parseMSSB parses an MSSB statement in any of its file formats: data
+// beginning with the OLE2 signature are parsed as a legacy .xls workbook
+// (ParseXLS), data beginning with a zip header as an .xlsx workbook
+// (ParseXLSX), and any other data as CSV (ParseCSV).
+func parseMSSB(data []byte, opts *Options) ([]*Entry, *Meta, error) {
+	switch {
+	case bytes.HasPrefix(data, ole2Magic):
+		return ParseXLS(data, opts)
+	case bytes.HasPrefix(data, zipMagic):
+		return ParseXLSX(data, opts)
+	default:
+		return ParseCSV(data, opts)
+	}
+}
+
+var (
+	ole2Magic = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// ErrInvalidXLS is reported, wrapped with the details, for .xls data that the
+// decoder cannot read.
+var ErrInvalidXLS = errors.New("invalid xls data")
+
+// xlsMaxRows is the number of rows of a BIFF8 worksheet. ParseXLS reads at
+// most this many rows from all the worksheets of a workbook.
+const xlsMaxRows = 1 << 16
+
 // ParseXLS extracts the gain/loss entries from the statement in data,
-// returning those matched by the options (or all if opts == nil).
-func ParseXLS(data []byte, opts *Options) ([]*Entry, error) {
+// returning those matched by the options (or all if opts == nil), along with
+// the metadata stated in the header of the report.
+//
+// The underlying XLS decoder may panic on truncated or corrupt input; such a
+// panic, like any other failure of the decoder, is reported as an error
+// wrapping ErrInvalidXLS.
+func ParseXLS(data []byte, opts *Options) ([]*Entry, *Meta, error) {
+	rows, err := readXLS(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseEntries(rows, opts)
+}
+
+// readXLS decodes the cells of the workbook in data.
+func readXLS(data []byte) (rows [][]string, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			rows, err = nil, fmt.Errorf("%w: %v", ErrInvalidXLS, x)
+		}
+	}()
 	w, err := xls.OpenReader(bytes.NewReader(data), "utf-8")
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXLS, err)
+	} else if w == nil {
+		return nil, fmt.Errorf("%w: no workbook stream", ErrInvalidXLS)
 	}
-	return parseEntries(w.ReadAllCells(math.MaxInt32), opts)
+	rows = w.ReadAllCells(xlsMaxRows)
+	if err := w.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXLS, err)
+	}
+	return rows, nil
 }
 
 // ParseCSV extracts the gain/loss entries from the statement in data,
-// returning those matched by the options (or all if opts == nil).
+// returning those matched by the options (or all if opts == nil), along with
+// the metadata stated in the header of the report.
 //
 // The input data are expected to have a header row containing the standard
 // fields of the MSSB gain/loss report:
 //
-//	Acquired Date:              date as mm/dd/yyyy
+//	Acquired Date:              date as mm/dd/yyyy or yyyy-mm-dd
 //	Plan Name:                  string
 //	Acquired Price:             price as $ddd.cc
 //	Acquired Via:               string
 //	Shares Available for Sale:  integer
 //	Current Market Value:       price as $ddd.cc
 //	Unrealized Total Gain/Loss: price as $ddd.cc (possibly negative)
-func ParseCSV(data []byte, opts *Options) ([]*Entry, error) {
-	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+//
+// A Grant Name column is optional; if present, it sets the Label of entries.
+// A Symbol column is also optional; if present, it sets the Symbol of entries
+// in place of the symbol stated in the header of the report.
+func ParseCSV(data []byte, opts *Options) ([]*Entry, *Meta, error) {
+	rows, err := readCSV(data)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	return parseEntries(rows, opts)
 }
 
+// readCSV decodes the rows of the CSV data.
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff")) // byte order mark
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1 // header rows may differ in length from entries
+	return r.ReadAll()
+}
+
 // parseEntries converts a slice of rows and columns into entries.
 // If filter == nil all entries are returned, otherwise only those for which
-// the filter returns true.
-func parseEntries(rows [][]string, opts *Options) ([]*Entry, error) {
-	var parser func([]string) (*Entry, error)
-	var i int
-nextRow:
-	for ; i < len(rows); i++ {
-		row := rows[i]
-		if len(row) != len(parse) {
-			continue
-		}
-		for _, key := range row {
-			if _, ok := parse[strings.ToLower(key)]; !ok {
-				continue nextRow
-			}
-		}
-		// Found the header row.
-		parser = newParser(row)
-		break
-	}
-
-	if parser == nil {
-		return nil, errors.New("unable to locate the header")
+// the filter returns true. Rows preceding the header are parsed as metadata.
+func parseEntries(rows [][]string, opts *Options) ([]*Entry, *Meta, error) {
+	i := findHeader(rows)
+	if i < 0 {
+		return nil, nil, errNoHeader
 	}
+	parser := newParser(rows[i])
+	meta := parseMeta(rows[:i])
 
 	var entries []*Entry
 	filter := opts.filter()
@@ -107,19 +241,78 @@ nextRow:
 		}
 		e, err := parser(rows[i])
 		if err != nil {
-			return nil, fmt.Errorf("row %d: %v", i+1, err)
+			return nil, nil, fmt.Errorf("row %d: %v", i+1, err)
+		}
+		e.LongTerm = opts.longTerm().HeldPast(e.Acquired)
+		if e.Symbol == "" {
+			e.Symbol = meta.Symbol
+		} else if meta.Symbol == "" {
+			meta.Symbol = e.Symbol // stated per row rather than in the header
+		}
+		// Unmarked amounts are in the currency of the statement, which may be
+		// known only from a later row.
+		if e.Currency != "" && meta.Currency == "" {
+			meta.Currency = e.Currency // marked on the amounts of a row
+		} else if e.Currency != "" && e.Currency != meta.Currency {
+			return nil, nil, fmt.Errorf("row %d: amounts in %s in a statement in %s", i+1, e.Currency, meta.Currency)
 		}
 		if filter(e) {
 			entries = append(entries, opts.fixPrice(e))
 		}
 	}
+	if meta.Currency == "" {
+		meta.Currency = "USD"
+	}
+	for _, e := range entries {
+		e.Currency = cmp.Or(e.Currency, meta.Currency)
+	}
 	sort.Slice(entries, func(i, j int) bool {
 		return entries[i].Acquired.Before(entries[j].Acquired)
 	})
 	for i, e := range entries {
 		e.Index = i + 1
 	}
-	return entries, nil
+	return entries, meta, nil
+}
+
+var errNoHeader = errors.New("unable to locate the header")
+
+// findHeader returns the index of the header row of rows, or -1 if there is
+// none. The header row has only known columns, including all the required
+// ones (those in fieldPos).
+func findHeader(rows [][]string) int {
+nextRow:
+	for i, row := range rows {
+		required := 0
+		for _, key := range row {
+			key = strings.ToLower(key)
+			if _, ok := parse[key]; !ok {
+				continue nextRow
+			} else if _, ok := fieldPos[key]; ok {
+				required++
+			}
+		}
+		if required == len(fieldPos) {
+			return i
+		}
+	}
+	return -1
+}
+
+// DateFormat is the layout of dates in output, as ISO 8601 (YYYY-MM-DD).
+const DateFormat = "2006-01-02"
+
+// dateFormats are the accepted layouts of dates in input statements.
+var dateFormats = []string{"01/02/2006", DateFormat}
+
+// parseDate parses a date in any of the accepted input formats.
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateFormats {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
 }
 
 const (
@@ -127,12 +320,14 @@ const (
 	acquiredPrice   = "acquired price"
 	acquiredVia     = "acquired via"
 	currentValue    = "current market value"
+	grantName       = "grant name"
 	planName        = "plan name"
 	sharesAvailable = "shares available for sale"
+	symbolName      = "symbol"
 	totalGainLoss   = "unrealized total gain/loss"
 )
 
-// fieldPos maps column names to field positions.
+// fieldPos maps the names of required columns to field positions.
 var fieldPos = map[string]int{
 	acquiredDate:    0,
 	acquiredPrice:   2,
@@ -146,7 +341,7 @@ var fieldPos = map[string]int{
 // parse maps column names to functions parsing their values.
 var parse = map[string]func(string, *Entry) error{
 	acquiredDate: func(s string, into *Entry) error {
-		t, err := time.Parse("01/02/2006", s)
+		t, err := parseDate(s)
 		into.Acquired = t
 		return err
 	},
@@ -155,40 +350,68 @@ var parse = map[string]func(string, *Entry) error{
 		return nil
 	},
 	acquiredPrice: func(s string, into *Entry) error {
-		c, err := currency.ParseUSD(s)
-		into.IssuePrice = c
+		a, err := parseAmount(s, into)
+		into.IssuePrice = a
 		return err
 	},
 	acquiredVia: func(s string, into *Entry) error {
 		into.Via = s
 		return nil
 	},
+	grantName: func(s string, into *Entry) error {
+		into.Label = strings.TrimSpace(s)
+		return nil
+	},
+	symbolName: func(s string, into *Entry) error {
+		into.Symbol = strings.TrimSpace(s)
+		return nil
+	},
 	sharesAvailable: func(s string, into *Entry) error {
 		n, err := strconv.Atoi(s)
 		into.Available = n
 		return err
 	},
 	currentValue: func(s string, into *Entry) error {
-		c, err := currency.ParseUSD(s)
-		into.Price = c
+		a, err := parseAmount(s, into)
+		into.Price = a
 		return err
 	},
 	totalGainLoss: func(s string, into *Entry) error {
-		c, err := currency.ParseUSD(s)
-		into.Gain = c
+		a, err := parseAmount(s, into)
+		into.Gain = a
 		return err
 	},
 }
 
+// parseAmount parses an amount of currency for e. If the amount is marked with
+// a currency, it must be the same as that of the other amounts of e.
+func parseAmount(s string, e *Entry) (currency.Value, error) {
+	a, err := currency.ParseAmount(s)
+	if err != nil {
+		return 0, err
+	} else if a.Code != "" {
+		if e.Currency != "" && e.Currency != a.Code {
+			return 0, fmt.Errorf("amounts in both %s and %s", e.Currency, a.Code)
+		}
+		e.Currency = a.Code
+	}
+	return a.Value, nil
+}
+
 // An Entry represents a group of shares acquired at a particular time.
 type Entry struct {
 	Index      int            // batch index
+	Symbol     string         // symbol of the security, if stated
+	Currency   string         // currency code of amounts, e.g., "USD"
 	Acquired   time.Time      // when the shares were issued
 	Plan       string         // under what plan
 	Available  int            // how many shares are available
 	Via        string         // how they were received
+	Label      string         // a descriptive label, such as the grant name
 	IssuePrice currency.Value // price per share at issue
 	Price      currency.Value // value per share currently (estimated)
+	Stated     currency.Value // value per share as stated in the statement
+	LongTerm   time.Time      // first date on which a sale is long-term
 	Gain       currency.Value // capital gain/loss per share (via estimated value)
 }
 
@@ -198,11 +421,18 @@ func (e *Entry) Format(n int) string {
 	if n < 0 || n > e.Available {
 		n = e.Available
 	}
-	return fmt.Sprintf("%2d %s -- acquired %s : issue %s price %s gains %s",
-		n, e.Plan, e.Acquired.Format("2006-01-02"),
-		e.IssuePrice.USD(), e.Price.USD(), e.Gain.USD())
+	plan := e.Plan
+	if e.Label != "" {
+		plan += " (" + e.Label + ")"
+	}
+	return fmt.Sprintf("%2d %s -- acquired %s long-term %s : issue %s price %s gains %s",
+		n, plan, e.Acquired.Format(DateFormat), e.LongTerm.Format(DateFormat),
+		e.IssuePrice.Format(e.Currency), e.Price.Format(e.Currency), e.Gain.Format(e.Currency))
 }
 
+// IsLongTerm reports whether a sale of e on the given date is long-term.
+func (e *Entry) IsLongTerm(sold time.Time) bool { return !sold.Before(e.LongTerm) }
+
 // newParser constructs a row parsing function given a header row.
 func newParser(header []string) func([]string) (*Entry, error) {
 	parser := make([]func(string, *Entry) error, len(header))
@@ -230,6 +460,7 @@ func newParser(header []string) func([]string) (*Entry, error) {
 			entry.Price /= n
 			entry.Gain /= n
 		}
+		entry.Stated = entry.Price
 		return &entry, nil
 	}
 }
@@ -246,26 +477,41 @@ func EntryLess(a, b *Entry) bool {
 	return a.Acquired.Before(b.Acquired)
 }
 
-// WriteCSV renders entries as CSV to w.
+// WriteCSV renders entries as CSV to w, in the format read by ParseCSV.
+// Dates are written in ISO 8601 format (DateFormat).
 func WriteCSV(entries []*Entry, w io.Writer) error {
 	cw := csv.NewWriter(w)
-	row := make([]string, len(fieldPos))
+	// The optional grant name column is written only if some entry has a label.
+	ncol := len(fieldPos)
+	for _, e := range entries {
+		if e.Label != "" {
+			ncol++
+			break
+		}
+	}
+	row := make([]string, ncol)
 	for name, pos := range fieldPos {
 		row[pos] = name
 	}
+	if ncol > len(fieldPos) {
+		row[len(fieldPos)] = grantName
+	}
 	if err := cw.Write(row); err != nil {
 		return err
 	}
 	for _, e := range entries {
 		n := currency.Value(e.Available)
 
-		row[fieldPos[acquiredDate]] = e.Acquired.Format("01/02/2006")
+		row[fieldPos[acquiredDate]] = e.Acquired.Format(DateFormat)
 		row[fieldPos[planName]] = e.Plan
 		row[fieldPos[sharesAvailable]] = strconv.Itoa(e.Available)
 		row[fieldPos[acquiredVia]] = e.Via
-		row[fieldPos[acquiredPrice]] = e.IssuePrice.USD()
-		row[fieldPos[currentValue]] = (n * e.Price).USD()
-		row[fieldPos[totalGainLoss]] = (n * e.Gain).USD()
+		row[fieldPos[acquiredPrice]] = e.IssuePrice.Format(e.Currency)
+		row[fieldPos[currentValue]] = (n * e.Price).Format(e.Currency)
+		row[fieldPos[totalGainLoss]] = (n * e.Gain).Format(e.Currency)
+		if ncol > len(fieldPos) {
+			row[len(fieldPos)] = e.Label
+		}
 
 		if err := cw.Write(row); err != nil {
 			return err
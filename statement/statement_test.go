@@ -0,0 +1,231 @@
+package statement_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/statement"
+)
+
+// readFile returns the contents of the named file in testdata.
+func readFile(t testing.TB, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Reading test data: %v", err)
+	}
+	return data
+}
+
+// checkParse reports an error unless a parse either failed with no result, or
+// succeeded with metadata and entries numbered in order.
+func checkParse(t *testing.T, es []*statement.Entry, meta *statement.Meta, err error) {
+	t.Helper()
+	if err != nil {
+		if es != nil || meta != nil {
+			t.Errorf("Parse: got %d entries and meta %+v with error %v", len(es), meta, err)
+		}
+		return
+	} else if meta == nil {
+		t.Error("Parse: got no metadata and no error")
+	}
+	for i, e := range es {
+		if e == nil {
+			t.Fatalf("Parse: entry %d is nil", i+1)
+		} else if e.Index != i+1 {
+			t.Errorf("Parse: entry %d has index %d", i+1, e.Index)
+		}
+	}
+}
+
+func FuzzParseXLS(f *testing.F) {
+	for _, name := range []string{"mssb.xls", "table.xls", "mssb.xlsx", "mssb.csv"} {
+		f.Add(readFile(f, name))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		es, meta, err := statement.ParseXLS(data, nil)
+		checkParse(t, es, meta, err)
+	})
+}
+
+func FuzzParseXLSX(f *testing.F) {
+	for _, name := range []string{"mssb.xlsx", "blanks.xlsx"} {
+		f.Add(readFile(f, name))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		es, meta, err := statement.ParseXLSX(data, nil)
+		checkParse(t, es, meta, err)
+	})
+}
+
+func FuzzParseCSV(f *testing.F) {
+	for _, name := range []string{"mssb.csv", "etrade.csv"} {
+		f.Add(readFile(f, name))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		es, meta, err := statement.ParseCSV(data, nil)
+		checkParse(t, es, meta, err)
+	})
+}
+
+func TestDates(t *testing.T) {
+	pst := time.FixedZone("PST", -8*60*60)
+	e := &statement.Entry{
+		Plan:       "GSU Class C",
+		Acquired:   time.Date(2021, 3, 4, 23, 30, 0, 0, pst),
+		LongTerm:   time.Date(2022, 3, 5, 0, 0, 0, 0, pst),
+		Available:  2,
+		IssuePrice: 40 * currency.Dollars,
+		Price:      100 * currency.Dollars,
+		Gain:       60 * currency.Dollars,
+	}
+	const want = " 2 GSU Class C -- acquired 2021-03-04 long-term 2022-03-05 : issue $40.00 price $100.00 gains $60.00"
+	if got := e.Format(-1); got != want {
+		t.Errorf("Format: got %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := statement.WriteCSV([]*statement.Entry{e}, &buf); err != nil {
+		t.Fatalf("WriteCSV: unexpected error: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Reading CSV: %v", err)
+	}
+	if len(rows) != 2 || !slices.Contains(rows[1], "2021-03-04") {
+		t.Errorf("WriteCSV: got rows %q, want one lot acquired %q", rows, "2021-03-04")
+	}
+}
+
+func TestParseXLS(t *testing.T) {
+	// The workbook has the cells of mssb.csv, with the numbers as numbers.
+	got, gotMeta, err := statement.ParseXLS(readFile(t, "mssb.xls"), nil)
+	if err != nil {
+		t.Fatalf("ParseXLS: unexpected error: %v", err)
+	}
+	want, wantMeta, err := statement.ParseCSV(readFile(t, "mssb.csv"), nil)
+	if err != nil {
+		t.Fatalf("ParseCSV: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(gotMeta, wantMeta) {
+		t.Errorf("ParseXLS: got meta %+v, want %+v", gotMeta, wantMeta)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParseXLS: got %d entries, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("ParseXLS: entry %d is %+v, want %+v", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestParseXLSErrors(t *testing.T) {
+	// In mssb.xls, sector 0 is the allocation table, sector 1 the directory,
+	// and sectors 2 to 9 the workbook stream.
+	data := readFile(t, "mssb.xls")
+	corrupt := func(f func([]byte)) []byte {
+		out := bytes.Clone(data)
+		f(out)
+		return out
+	}
+	setSector := func(d []byte, sid, next uint32) {
+		binary.LittleEndian.PutUint32(d[512+4*sid:], next)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"Truncated", data[:600]},
+		{"TableTooLarge", corrupt(func(d []byte) { binary.LittleEndian.PutUint32(d[44:], 1000) })},
+		{"CyclicChain", corrupt(func(d []byte) { setSector(d, 9, 2) })},
+		{"ChainOffTable", corrupt(func(d []byte) { setSector(d, 5, 500) })},
+		{"NoWorkbook", corrupt(func(d []byte) { copy(d[1024+128:], "X\x00") })},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			es, meta, err := statement.ParseXLS(tc.data, nil)
+			if !errors.Is(err, statement.ErrInvalidXLS) {
+				t.Errorf("ParseXLS: got %d entries, meta %+v, error %v; want %v", len(es), meta, err, statement.ErrInvalidXLS)
+			}
+		})
+	}
+}
+
+func TestParseXLSXBlanks(t *testing.T) {
+	// The workbook omits blank cells, including the last cell of two rows,
+	// and the blank row separating the entries from the totals.
+	got, gotMeta, err := statement.ParseXLSX(readFile(t, "blanks.xlsx"), nil)
+	if err != nil {
+		t.Fatalf("ParseXLSX: unexpected error: %v", err)
+	}
+	const csv = `Gain/Loss report
+,Symbol: GOOG
+Acquired Date,Plan Name,Acquired Price,Acquired Via,Shares Available for Sale,Current Market Value,Unrealized Total Gain/Loss,Grant Name
+01/15/2020,GSU Class C,$700.00,Release,10,$15000.00,$8000.00,G-1001
+02/29/2020,GSU Class C,$1200.00,,5,$7500.00,$1500.00,
+06/15/2024,GSU Class C,$1600.00,Release,8,$12000.00,-$800.00,
+`
+	want, wantMeta, err := statement.ParseCSV([]byte(csv), nil)
+	if err != nil {
+		t.Fatalf("ParseCSV: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(gotMeta, wantMeta) {
+		t.Errorf("ParseXLSX: got meta %+v, want %+v", gotMeta, wantMeta)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParseXLSX: got %d entries, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("ParseXLSX: entry %d is %+v, want %+v", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		file    string
+		want    statement.Format
+		entries int
+	}{
+		{"mssb.csv", statement.MSSB, 3},
+		{"mssb.xls", statement.MSSB, 3},
+		{"mssb.xlsx", statement.MSSB, 3},
+		{"table.xls", statement.MSSB, 0},
+		{"schwab.csv", statement.Schwab, 2},
+		{"etrade.csv", statement.ETrade, 2},
+
+		// The Schwab format also detects this statement, through the column
+		// names the two share, but recognizes fewer of its columns.
+		{"fidelity.csv", statement.Fidelity, 2},
+	}
+	for _, tc := range tests {
+		data := readFile(t, tc.file)
+		got := statement.DetectFormat(data)
+		if got != tc.want {
+			t.Errorf("DetectFormat(%s): got %s, want %s", tc.file, got.Name(), tc.want.Name())
+			continue
+		} else if !got.Detect(data) {
+			t.Errorf("%s.Detect(%s): got false, want true", got.Name(), tc.file)
+		}
+		if tc.entries == 0 {
+			continue // not a statement
+		}
+		es, _, err := got.Parse(data, nil)
+		if err != nil {
+			t.Errorf("%s.Parse(%s): unexpected error: %v", got.Name(), tc.file, err)
+		} else if len(es) != tc.entries {
+			t.Errorf("%s.Parse(%s): got %d entries, want %d", got.Name(), tc.file, len(es), tc.entries)
+		}
+	}
+}
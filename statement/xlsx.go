@@ -0,0 +1,268 @@
+package statement
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseXLSX extracts the gain/loss entries from the first worksheet of the
+// Office Open XML (.xlsx) workbook in data, returning those matched by the
+// options (or all if opts == nil), along with the metadata stated in the
+// header of the report.
+//
+// Numeric cells formatted as dates are converted to mm/dd/yyyy, so that the
+// entries are the same as those parsed from the equivalent .xls or CSV data.
+func ParseXLSX(data []byte, opts *Options) ([]*Entry, *Meta, error) {
+	rows, err := readXLSX(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseEntries(rows, opts)
+}
+
+// The parts of the workbook needed to read the cells of a worksheet.
+type (
+	xlsxWorkbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	xlsxRels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	xlsxStrings struct {
+		Items []xlsxText `xml:"si"`
+	}
+	xlsxText struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+	xlsxStyles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	xlsxSheet struct {
+		Rows []struct {
+			Num   int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Style  int      `xml:"s,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+)
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	for _, r := range t.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+// readXLSX decodes the cells of the first worksheet of the workbook in data.
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx data: %v", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	decode := func(name string, v interface{}, required bool) error {
+		f, ok := files[name]
+		if !ok {
+			if required {
+				return fmt.Errorf("invalid xlsx data: missing %s", name)
+			}
+			return nil
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if err := xml.NewDecoder(rc).Decode(v); err != nil && err != io.EOF {
+			return fmt.Errorf("invalid xlsx data: %s: %v", name, err)
+		}
+		return nil
+	}
+
+	// Locate the first worksheet through the workbook relationships.
+	var wb xlsxWorkbook
+	var rels xlsxRels
+	if err := decode("xl/workbook.xml", &wb, true); err != nil {
+		return nil, err
+	} else if err := decode("xl/_rels/workbook.xml.rels", &rels, true); err != nil {
+		return nil, err
+	} else if len(wb.Sheets) == 0 {
+		return nil, errors.New("invalid xlsx data: no worksheets")
+	}
+	var sheetPath string
+	for _, r := range rels.Rels {
+		if r.ID == wb.Sheets[0].ID {
+			sheetPath = path.Join("xl", r.Target)
+			if strings.HasPrefix(r.Target, "/") {
+				sheetPath = strings.TrimPrefix(r.Target, "/")
+			}
+		}
+	}
+	var ss xlsxStrings
+	var styles xlsxStyles
+	var sheet xlsxSheet
+	if err := decode("xl/sharedStrings.xml", &ss, false); err != nil {
+		return nil, err
+	} else if err := decode("xl/styles.xml", &styles, false); err != nil {
+		return nil, err
+	} else if err := decode(sheetPath, &sheet, true); err != nil {
+		return nil, err
+	}
+
+	customDate := make(map[int]bool)
+	for _, f := range styles.NumFmts {
+		customDate[f.ID] = isDateFormat(f.Code)
+	}
+	isDate := func(style int) bool {
+		if style < 0 || style >= len(styles.CellXfs) {
+			return false
+		}
+		id := styles.CellXfs[style].NumFmtID
+		return (id >= 14 && id <= 22) || (id >= 45 && id <= 47) || customDate[id]
+	}
+
+	// Rows and cells may be omitted; place each in the row and column of its
+	// reference. A row with no text, such as the blank row separating the
+	// entries from the totals, is empty.
+	var rows [][]string
+	for _, r := range sheet.Rows {
+		i := len(rows)
+		if r.Num > 0 {
+			i = r.Num - 1
+		}
+		if i < len(rows) || i >= xlsxMaxRows {
+			return nil, fmt.Errorf("invalid xlsx data: bad row number %d", r.Num)
+		}
+		for len(rows) < i {
+			rows = append(rows, nil)
+		}
+		var row []string
+		blank := true
+		for _, c := range r.Cells {
+			var text string
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(ss.Items) {
+					return nil, fmt.Errorf("invalid xlsx data: bad string index %q", c.Value)
+				}
+				text = ss.Items[n].String()
+			case "inlineStr":
+				text = c.Inline.String()
+			case "", "n":
+				text = xlsxNumber(c.Value, isDate(c.Style))
+			default:
+				text = c.Value
+			}
+
+			col := len(row)
+			if c.Ref != "" {
+				col = xlsxColumn(c.Ref)
+			}
+			if col < len(row) || col >= xlsxMaxColumns {
+				return nil, fmt.Errorf("invalid xlsx data: bad cell reference %q", c.Ref)
+			}
+			for len(row) < col {
+				row = append(row, "")
+			}
+			row = append(row, text)
+			blank = blank && strings.TrimSpace(text) == ""
+		}
+		if blank {
+			row = nil
+		}
+		rows = append(rows, row)
+	}
+
+	// A cell left blank at the end of a row is omitted, so pad the rows
+	// following the header to its width.
+	if h := findHeader(rows); h >= 0 {
+		for i := h + 1; i < len(rows); i++ {
+			for len(rows[i]) > 0 && len(rows[i]) < len(rows[h]) {
+				rows[i] = append(rows[i], "")
+			}
+		}
+	}
+	return rows, nil
+}
+
+// The dimensions of the largest worksheet.
+const (
+	xlsxMaxRows    = 1 << 20
+	xlsxMaxColumns = 1 << 14
+)
+
+// xlsxColumn returns the zero-based column index of a cell reference like
+// "C7", or -1 if ref does not begin with a column name of at most three
+// letters.
+func xlsxColumn(ref string) int {
+	col := 0
+	for i, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		} else if i == 3 {
+			return -1
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	return col - 1
+}
+
+// isDateFormat reports whether a custom number format code formats dates.
+func isDateFormat(code string) bool {
+	code = strings.ToLower(code)
+	return strings.ContainsAny(code, "dy") && !strings.Contains(code, "0")
+}
+
+// xlsxNumber formats the numeric cell value s. If date is true, s is a serial
+// day number and is formatted as mm/dd/yyyy. Otherwise integers are formatted
+// without a decimal point, and other values are rounded to cents, the
+// precision accepted by currency.ParseUSD.
+func xlsxNumber(s string, date bool) string {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	if date {
+		epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		return epoch.AddDate(0, 0, int(math.Floor(f))).Format("01/02/2006")
+	} else if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strings.TrimSuffix(strings.TrimRight(strconv.FormatFloat(f, 'f', 2, 64), "0"), ".")
+}
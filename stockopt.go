@@ -1,181 +1,174 @@
-// Program stockopt optimizes a stock sale subject to limitations of capital
-// gains.  The input to the program is an .xls spreadsheet as generated from
-// the Gain/Loss view of the MSSB stock plan site.
+// Package stockopt plans stock sales subject to limitations of capital gains.
 //
-// The output is a table listing how many of each lot of stock should be sold,
-// the total sale price based on the estimated sale values from MSSB, and the
-// total capital gain from the sale.
-package main
+// A Portfolio holds the lots of stock read from one or more statements. Build
+// selects the lots of a portfolio eligible for sale under a set of
+// Constraints and chooses which of them to sell, returning a Plan:
+//
+//	p, err := stockopt.Load([]string{"gainloss.xls"}, nil)
+//	...
+//	plan, err := stockopt.Build(p, &stockopt.Constraints{
+//	   GainsCap: 5000 * currency.Dollars,
+//	})
+//	...
+//	for _, elt := range plan.Result.Entries {
+//	   e := elt.ID.(*statement.Entry)
+//	   fmt.Printf("Sell %d of lot %d\n", elt.N, e.Index)
+//	}
+//
+// The stockopt program in cmd/stockopt is a command-line interface to this
+// package.
+package stockopt
 
 import (
-	"flag"
 	"fmt"
-	"log"
 	"os"
-	"path/filepath"
 	"sort"
-	"time"
 
 	"github.com/creachadair/stockopt/currency"
-	"github.com/creachadair/stockopt/solver"
 	"github.com/creachadair/stockopt/statement"
 )
 
-var (
-	inputPath    = flag.String("input", "", "Input .xls file")
-	ageMonths    = flag.Int("age", 12, "Minimum age in months (12 months is the short-term cutoff)")
-	planFilter   = flag.String("plan", "GSU Class C", "Consider only shares issued under this plan")
-	capGainLimit = flag.String("gain", "$0", "Capital gain limit in USD")
-	marketPrice  = flag.String("market", "$0", "Market price override in USD")
-	printSummary = flag.Bool("summary", false, "Print summary of available shares and exit")
-	allowLoss    = flag.Bool("loss", false, "Allow sale of capital losses")
-	taxRate      = flag.Int("tax", 20, "Capital gains tax rate (percent)")
-)
-
-func init() {
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, `Usage: %[1]s -input file.xls -summary  # summarize available shares
-       %[1]s -input file.xls -gain v   # generate a sale profile
-
-Read a MSSB gain/loss report from an .xls file and generate a stock sale
-profile that maximizes total sale value for a given market price without
-exceeding the specified maximum capital gain.
-
-By default:
-
-- The market price is derived from the value stated in the report; use -market
-  to use a different value, e.g., for a limit order.
-
-- Sales resulting in a capital loss are not considered; use -loss to allow the
-  optimizer to include sales resulting in a capital loss in the plan.
+// A Statement is a statement read into a portfolio. Its lots have the values
+// stated in the statement; a plan built from a portfolio does not modify them.
+type Statement struct {
+	Name   string             // the name of the statement, e.g., its file path
+	Format statement.Format   // the format of the statement
+	Meta   *statement.Meta    // the metadata stated in the statement
+	Lots   []*statement.Entry // the lots of the statement
+}
 
-- Only shares issued at least 12 months ago (the cutoff for long-term capital
-  gains) are considered for sale; use -age to set a different threshold.
+// A Portfolio is a collection of lots of stock read from statements.
+type Portfolio struct {
+	Statements []*Statement
+}
 
-Use -summary to report on all available shares without generating a sale
-profile.
+// LoadOptions control how statements are read into a portfolio. A nil
+// *LoadOptions is ready for use and provides default values.
+type LoadOptions struct {
+	// The format of the statements. If nil, the format of each statement is
+	// detected from its contents.
+	Format statement.Format
+
+	// The holding period after which a sale is long-term. If zero,
+	// statement.DefaultLongTerm is used.
+	LongTerm statement.Period
+
+	// If not empty, the code of the currency in which to express the amounts
+	// of all lots. The amounts of statements in other currencies are converted
+	// at the given exchange rates.
+	Currency string
+	Rates    currency.Rates
+}
 
-Options:
-`, filepath.Base(os.Args[0]))
-		flag.PrintDefaults()
+func (o *LoadOptions) format(data []byte) statement.Format {
+	if o == nil || o.Format == nil {
+		return statement.DetectFormat(data)
 	}
+	return o.Format
 }
 
-func main() {
-	flag.Parse()
-	if *inputPath == "" {
-		log.Fatal("You must provide an -input .xls path")
-	} else if *taxRate < 0 || *taxRate > 100 {
-		log.Fatal("You must provide a -tax rate between 0..100 percent")
+func (o *LoadOptions) parseOptions() *statement.Options {
+	if o == nil {
+		return nil
 	}
+	return &statement.Options{LongTerm: o.LongTerm}
+}
 
-	// Convert the capital gains cap into a currency value.
-	maxGain, err := currency.ParseUSD(*capGainLimit)
-	if err != nil {
-		log.Fatalf("Invalid cap %q: %v", *capGainLimit, err)
-	}
-	market, err := currency.ParseUSD(*marketPrice)
-	if err != nil {
-		log.Fatalf("Invalid market price %q: %v", *marketPrice, err)
+// Load reads the statements at the given paths into a new portfolio.
+func Load(paths []string, opts *LoadOptions) (*Portfolio, error) {
+	p := new(Portfolio)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Add(path, data, opts); err != nil {
+			return nil, err
+		}
 	}
+	return p, nil
+}
 
-	// Read and parse the input spreadsheet, filtering out entries with 0
-	// available shares, those issued more recently than the specified age, and
-	// not matching the specified plan filter.
-	data, err := os.ReadFile(*inputPath)
+// Add parses the statement in data and adds its lots to p. The name is used to
+// identify the statement in errors.
+func (p *Portfolio) Add(name string, data []byte, opts *LoadOptions) error {
+	f := opts.format(data)
+	es, meta, err := f.Parse(data, opts.parseOptions())
 	if err != nil {
-		log.Fatalf("Reading statement: %v", err)
+		return fmt.Errorf("parsing statement %q: %w", name, err)
 	}
-
-	then := time.Now().AddDate(0, -*ageMonths, 0)
-	es, err := statement.ParseXLS(data, &statement.Options{
-		Filter: func(e *statement.Entry) bool {
-			return e.Available > 0 && e.Acquired.Before(then) &&
-				(*planFilter == "" || e.Plan == *planFilter) &&
-				(e.Gain >= 0 || *allowLoss)
-		},
-		MarketPrice: market,
-	})
-	if err != nil {
-		log.Fatalf("Parsing statement: %v", err)
+	if opts != nil && opts.Currency != "" {
+		if err := convertLots(es, opts.Currency, opts.Rates); err != nil {
+			return fmt.Errorf("statement %q: %w", name, err)
+		}
 	}
+	p.Statements = append(p.Statements, &Statement{
+		Name:   name,
+		Format: f,
+		Meta:   meta,
+		Lots:   es,
+	})
+	return nil
+}
 
-	// Compute the total value of the portfolio, just for cosmetics.
-	var totalValue, totalGain, totalBasis currency.Value
-	var totalShares int
+// convertLots converts the amounts of es to the currency with the given code.
+func convertLots(es []*statement.Entry, code string, rates currency.Rates) error {
 	for _, e := range es {
-		totalShares += e.Available
-		v := currency.Value(e.Available)
-		totalValue += v * e.Price
-		totalGain += v * e.Gain
-		totalBasis += v * e.IssuePrice
+		if e.Currency == code {
+			continue
+		}
+		for _, v := range []*currency.Value{&e.IssuePrice, &e.Price, &e.Stated, &e.Gain} {
+			c, err := rates.Convert(*v, e.Currency, code)
+			if err != nil {
+				return err
+			}
+			*v = c
+		}
+		e.Currency = code
 	}
+	return nil
+}
 
-	fmt.Printf(`Input file:   %q
-Minimum age:   %d months
-Gains cap:     %s
-Allow loss:    %v
-Total shares:  %d
-Cost basis:    %s
-Present value: %s
-Total gains:   %s
-`, *inputPath, *ageMonths, maxGain.USD(), *allowLoss, totalShares,
-		totalBasis.USD(), totalValue.USD(), totalGain.USD())
-	if market > 0 {
-		fmt.Printf("Market price:  %s\n", market.USD())
+// Lots returns the lots of all the statements of p, in order of acquisition.
+func (p *Portfolio) Lots() []*statement.Entry {
+	var es []*statement.Entry
+	for _, s := range p.Statements {
+		es = append(es, s.Lots...)
 	}
+	sort.SliceStable(es, func(i, j int) bool { return es[i].Acquired.Before(es[j].Acquired) })
+	return es
+}
 
-	// If requested, print a summary of available shares.
-	if *printSummary {
-		fmt.Println("\nAvailable shares:")
-		for _, e := range es {
-			fmt.Printf("%2d. %s\n", e.Index, e.Format(-1))
-		}
-		return
+// Symbols returns the symbols of the securities stated in the statements of p,
+// in order of first appearance.
+func (p *Portfolio) Symbols() []string {
+	var out []string
+	for _, s := range p.Statements {
+		out = addUnique(out, s.Meta.Symbol)
 	}
-
-	fmt.Println()
-	solve(es, maxGain)
+	return out
 }
 
-func solve(es []*statement.Entry, maxGain currency.Value) {
-	soln := solver.New(es2e(es)).Solve(maxGain)
-	sort.Slice(soln, func(i, j int) bool {
-		return statement.EntryLess(soln[i].ID.(*statement.Entry), soln[j].ID.(*statement.Entry))
-	})
-
-	var soldValue, soldGains, costBasis currency.Value
-	var soldShares int
-	for _, elt := range soln {
-		e := elt.ID.(*statement.Entry)
-		soldShares += elt.N
-		vn := currency.Value(elt.N)
-		costBasis += vn * e.IssuePrice
-		soldValue += vn * elt.Value
-		soldGains += vn * elt.Gain
-		fmt.Printf("Sell [lot %2d]: %s\n", e.Index, e.Format(elt.N))
-	}
-	fmt.Printf("\nSold shares:\t%d\nSold value:\t%s\nSold gains:\t%s\nCost basis:\t%s\n",
-		soldShares, soldValue.USD(), soldGains.USD(), costBasis.USD())
-	if *taxRate > 0 {
-		tax := (soldGains * currency.Value(*taxRate)) / 100
-		fmt.Printf("%d%% gains tax:\t%s\n", *taxRate, tax.USD())
+// Currencies returns the currencies of the statements of p, in order of first
+// appearance. These are the currencies stated in the statements, even if the
+// amounts of their lots were converted to another currency.
+func (p *Portfolio) Currencies() []string {
+	var out []string
+	for _, s := range p.Statements {
+		out = addUnique(out, s.Meta.Currency)
 	}
-
-	// N.B.: We sum the cost bases per lot instead of taking the ending bounds,
-	// so that rounding does not occur per transaction.
+	return out
 }
 
-// es2e converts statement entries to solver entries.
-func es2e(es []*statement.Entry) []solver.Entry {
-	out := make([]solver.Entry, len(es))
-	for i, e := range es {
-		out[i] = solver.Entry{
-			ID:    e,
-			N:     e.Available,
-			Value: e.Price,
-			Gain:  e.Gain,
+// addUnique returns ss with s added, if s is not empty and not already in ss.
+func addUnique(ss []string, s string) []string {
+	if s == "" {
+		return ss
+	}
+	for _, v := range ss {
+		if v == s {
+			return ss
 		}
 	}
-	return out
+	return append(ss, s)
 }
@@ -0,0 +1,203 @@
+package stockopt_test
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/creachadair/stockopt"
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/report"
+	"github.com/creachadair/stockopt/solver"
+	"github.com/creachadair/stockopt/statement"
+)
+
+var saleDate = time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func Example_build() {
+	p, err := stockopt.Load([]string{"statement/testdata/mssb.csv"}, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	plan, err := stockopt.Build(p, &stockopt.Constraints{
+		SaleDate: saleDate,
+		GainsCap: 1000 * currency.Dollars,
+		Plan:     "GSU Class C",
+		TaxRate:  20,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, elt := range plan.Result.Entries {
+		e := elt.ID.(*statement.Entry)
+		fmt.Printf("Sell [lot %2d]: %s\n", e.Index, e.Format(elt.N))
+	}
+	sum := stockopt.Summarize(plan.Result.Entries)
+	fmt.Printf("Sold shares: %d\nSold gains: %s\nTax: %s\n", sum.Shares, sum.Gains.USD(),
+		plan.Constraints.Tax(plan.Result.Entries).USD())
+	// Output:
+	// Sell [lot  2]:  3 GSU Class C -- acquired 2020-02-29 long-term 2021-03-01 : issue $1200.00 price $1500.00 gains $300.00
+	// Sold shares: 3
+	// Sold gains: $900.00
+	// Tax: $180.00
+}
+
+// A statement with lots of two plans, one of them at a loss and one of them
+// short-term on saleDate.
+const testStatement = `Gain/Loss report
+Symbol: GOOG
+Acquired Date,Plan Name,Acquired Price,Acquired Via,Shares Available for Sale,Current Market Value,Unrealized Total Gain/Loss
+01/15/2020,GSU Class C,$700.00,Release,10,$15000.00,$8000.00
+02/29/2020,GSU Class C,$1200.00,Release,5,$7500.00,$1500.00
+03/02/2021,ESPP,$1000.00,Purchase,4,$6000.00,$2000.00
+06/15/2024,GSU Class C,$1600.00,Release,8,$12000.00,-$800.00
+09/02/2025,GSU Class C,$1400.00,Release,2,$3000.00,$200.00
+`
+
+func TestBuild(t *testing.T) {
+	p := new(stockopt.Portfolio)
+	if err := p.Add("test.csv", []byte(testStatement), nil); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	// The expected plans are those printed by the stockopt program for the
+	// same statement, e.g.,
+	//
+	//	stockopt -date 2025-10-01 -gain '$1200' -max-lot-fraction 0.5
+	//
+	tests := []struct {
+		name string
+		c    stockopt.Constraints
+		want map[int]int // shares sold, by lot number
+		tax  currency.Value
+	}{
+		{"GainsCap", stockopt.Constraints{GainsCap: 1000 * currency.Dollars}, map[int]int{2: 3}, 180 * currency.Dollars},
+		{"LargerCap", stockopt.Constraints{GainsCap: 1200 * currency.Dollars}, map[int]int{2: 4}, 240 * currency.Dollars},
+		{"LotCeiling", stockopt.Constraints{GainsCap: 1200 * currency.Dollars, MaxLotFraction: 0.5},
+			map[int]int{2: 2}, 120 * currency.Dollars},
+		{"Market", stockopt.Constraints{GainsCap: 900 * currency.Dollars, MarketPrice: 1300 * currency.Dollars},
+			map[int]int{2: 5}, 100 * currency.Dollars},
+		{"Plan", stockopt.Constraints{GainsCap: 1000 * currency.Dollars, Plan: "ESPP"}, map[int]int{1: 2}, 200 * currency.Dollars},
+		{"NoGain", stockopt.Constraints{GainsCap: 100 * currency.Dollars}, map[int]int{}, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.c
+			c.SaleDate = saleDate
+			c.Plan = cmp.Or(c.Plan, "GSU Class C")
+			c.TaxRate = 20
+			plan, err := stockopt.Build(p, &c)
+			if err != nil {
+				t.Fatalf("Build: unexpected error: %v", err)
+			}
+			got := make(map[int]int)
+			for _, elt := range plan.Result.Entries {
+				e := elt.ID.(*statement.Entry)
+				got[e.Index] += elt.N
+				if n := plan.Constraints.LotCeiling(e); elt.N > n {
+					t.Errorf("Lot %d: sold %d shares, more than the ceiling %d", e.Index, elt.N, n)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Build: sold %v, want %v", got, tc.want)
+			}
+			sum := stockopt.Summarize(plan.Result.Entries)
+			if sum.Gains > c.GainsCap {
+				t.Errorf("Build: gains %v exceed the cap %v", sum.Gains, c.GainsCap)
+			}
+			if tax := plan.Constraints.Tax(plan.Result.Entries); tax != tc.tax {
+				t.Errorf("Tax: got %v, want %v", tax, tc.tax)
+			}
+
+			// The lots of the portfolio are not modified by the plan.
+			for _, e := range p.Lots() {
+				if e.Price != e.Stated {
+					t.Errorf("Lot %v: price changed to %v", e.Acquired.Format(statement.DateFormat), e.Price)
+				}
+			}
+		})
+	}
+}
+
+func TestLotCeiling(t *testing.T) {
+	e := &statement.Entry{Available: 7}
+	for _, tc := range []struct {
+		frac float64
+		want int
+	}{{0, 7}, {0.5, 3}, {0.1, 0}, {1, 7}} {
+		c := &stockopt.Constraints{MaxLotFraction: tc.frac}
+		if got := c.LotCeiling(e); got != tc.want {
+			t.Errorf("LotCeiling(%v): got %d, want %d", tc.frac, got, tc.want)
+		}
+	}
+}
+
+func TestTax(t *testing.T) {
+	e := &statement.Entry{IssuePrice: 100 * currency.Dollars}
+	soln := []solver.Entry{
+		{ID: e, N: 3, Gain: 300 * currency.Dollars, LongTerm: true},
+		{ID: e, N: 2, Gain: 100 * currency.Dollars},
+		{ID: e, N: 1, Gain: -50 * currency.Dollars, LongTerm: true},
+	}
+	tests := []struct {
+		name string
+		c    stockopt.Constraints
+		want currency.Value
+	}{
+		// 20% of $1050.
+		{"Flat", stockopt.Constraints{TaxRate: 20}, 210 * currency.Dollars},
+
+		// 15% of the long-term $850, and 40% of the short-term $200.
+		{"Term", stockopt.Constraints{TaxRate: 15, TaxShortTerm: true, ShortTaxRate: 40},
+			207*currency.Dollars + 50*currency.Cents},
+
+		{"None", stockopt.Constraints{}, 0},
+	}
+	for _, tc := range tests {
+		if got := tc.c.Tax(soln); got != tc.want {
+			t.Errorf("Tax %s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestReport checks that the report of a plan is the same as the JSON output
+// of the stockopt program for the same statement, in testdata/plan.json:
+//
+//	stockopt -input statement/testdata/mssb.csv -gain '$1000' -date 2025-10-01 -output json
+func TestReport(t *testing.T) {
+	want, err := os.ReadFile("testdata/plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := stockopt.Load([]string{"statement/testdata/mssb.csv"}, nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	plan, err := stockopt.Build(p, &stockopt.Constraints{
+		SaleDate: saleDate,
+		GainsCap: 1000 * currency.Dollars,
+		Plan:     "GSU Class C",
+		TaxRate:  20,
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf, plan.Report(report.Params{
+		SaleDate: saleDate.Format(statement.DateFormat),
+		MinAge:   "long-term (held more than 1y)",
+		GainsCap: "$1000.00",
+		TaxRate:  20,
+		Currency: "USD",
+	})); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("Report: got\n%s\nwant\n%s", got, want)
+	}
+}
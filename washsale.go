@@ -0,0 +1,88 @@
+package stockopt
+
+import (
+	"sort"
+	"time"
+
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/solver"
+	"github.com/creachadair/stockopt/statement"
+)
+
+// WashWindow is the number of days before or after a sale during which the
+// purchase of replacement shares makes a loss on the sale a wash sale.
+const WashWindow = 30
+
+// InWashWindow reports whether t is within the wash-sale window of saleDate.
+func InWashWindow(t, saleDate time.Time) bool {
+	return !t.Before(saleDate.AddDate(0, 0, -WashWindow)) &&
+		!t.After(saleDate.AddDate(0, 0, WashWindow))
+}
+
+// WashReplacement returns a lot of recent whose acquisition would make a sale
+// of e at a loss on saleDate a wash sale, or nil if there is none. Such a lot
+// is another lot of the same security acquired within the wash-sale window.
+func WashReplacement(e *statement.Entry, recent []*statement.Entry, saleDate time.Time) *statement.Entry {
+	for _, r := range recent {
+		if r != e && r.Symbol == e.Symbol && r.Available > 0 && InWashWindow(r.Acquired, saleDate) {
+			return r
+		}
+	}
+	return nil
+}
+
+// A WashAdjustment records the disallowed loss carried to the basis of some of
+// the shares of a replacement lot.
+type WashAdjustment struct {
+	Lot        *statement.Entry // the replacement lot
+	Shares     int              // the number of replacement shares adjusted
+	Disallowed currency.Value   // the per-share loss added to the basis
+}
+
+// WashSales computes the basis adjustments that the losses realized by soln
+// would carry to the replacement lots in recent. A replacement share is one
+// of the same security acquired within the wash-sale window of saleDate that
+// is not sold by soln. Losses are matched to replacement shares in order of
+// acquisition, one share for one share. The IDs of soln must be of type
+// *statement.Entry.
+func WashSales(soln []solver.Entry, recent []*statement.Entry, saleDate time.Time) []WashAdjustment {
+	sold := make(map[*statement.Entry]int)
+	for _, elt := range soln {
+		sold[elt.ID.(*statement.Entry)] += elt.N
+	}
+	repl := make([]*statement.Entry, len(recent))
+	copy(repl, recent)
+	sort.SliceStable(repl, func(i, j int) bool { return repl[i].Acquired.Before(repl[j].Acquired) })
+	left := make(map[*statement.Entry]int)
+	for _, r := range repl {
+		left[r] = r.Available - sold[r]
+	}
+
+	losses := make([]solver.Entry, 0, len(soln))
+	for _, elt := range soln {
+		if elt.Gain < 0 {
+			losses = append(losses, elt)
+		}
+	}
+	sort.SliceStable(losses, func(i, j int) bool {
+		return losses[i].ID.(*statement.Entry).Acquired.Before(losses[j].ID.(*statement.Entry).Acquired)
+	})
+
+	var adj []WashAdjustment
+	for _, elt := range losses {
+		e := elt.ID.(*statement.Entry)
+		need := elt.N
+		for _, r := range repl {
+			if need == 0 {
+				break
+			} else if r == e || r.Symbol != e.Symbol || left[r] == 0 || !InWashWindow(r.Acquired, saleDate) {
+				continue
+			}
+			n := min(need, left[r])
+			left[r] -= n
+			need -= n
+			adj = append(adj, WashAdjustment{Lot: r, Shares: n, Disallowed: -elt.Gain})
+		}
+	}
+	return adj
+}
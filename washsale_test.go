@@ -0,0 +1,125 @@
+package stockopt_test
+
+import (
+	"testing"
+
+	"github.com/creachadair/stockopt"
+	"github.com/creachadair/stockopt/currency"
+	"github.com/creachadair/stockopt/solver"
+	"github.com/creachadair/stockopt/statement"
+)
+
+// washLot returns a lot of n shares of GOOG under the given plan, acquired
+// the given number of days after saleDate.
+func washLot(plan string, days, n int) *statement.Entry {
+	return &statement.Entry{
+		Symbol:    "GOOG",
+		Plan:      plan,
+		Acquired:  saleDate.AddDate(0, 0, days),
+		Available: n,
+	}
+}
+
+func TestInWashWindow(t *testing.T) {
+	tests := []struct {
+		days int
+		want bool
+	}{
+		{-31, false}, {-30, true}, {-1, true}, {0, true}, {1, true}, {30, true}, {31, false},
+	}
+	for _, tc := range tests {
+		if got := stockopt.InWashWindow(saleDate.AddDate(0, 0, tc.days), saleDate); got != tc.want {
+			t.Errorf("InWashWindow(%+d days): got %v, want %v", tc.days, got, tc.want)
+		}
+	}
+}
+
+func TestWashReplacement(t *testing.T) {
+	sold := washLot("GSU Class C", -500, 8)
+	other := washLot("GSU Class C", 0, 4)
+	other.Symbol = "GOOGL"
+	empty := washLot("GSU Class C", 0, 0)
+
+	tests := []struct {
+		name   string
+		recent *statement.Entry
+		want   bool
+	}{
+		{"Before", washLot("GSU Class C", -30, 4), true},
+		{"After", washLot("GSU Class C", 30, 4), true},
+		{"TooEarly", washLot("GSU Class C", -31, 4), false},
+		{"TooLate", washLot("GSU Class C", 31, 4), false},
+
+		// Shares of the same security are substantially identical whatever
+		// their plan.
+		{"OtherPlan", washLot("ESPP", -10, 4), true},
+		{"OtherSymbol", other, false},
+		{"NoShares", empty, false},
+		{"Self", sold, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := stockopt.WashReplacement(sold, []*statement.Entry{tc.recent}, saleDate)
+			if got := r != nil; got != tc.want {
+				t.Errorf("WashReplacement: got %v, want replacement %v", r, tc.want)
+			} else if r != nil && r != tc.recent {
+				t.Errorf("WashReplacement: got %v, want %v", r, tc.recent)
+			}
+		})
+	}
+}
+
+func TestWashSales(t *testing.T) {
+	lossLot := washLot("GSU Class C", -500, 8)
+	gainLot := washLot("GSU Class C", -900, 10)
+	sell := func(e *statement.Entry, n int, gain currency.Value) solver.Entry {
+		return solver.Entry{ID: e, N: n, Value: 1500 * currency.Dollars, Gain: gain}
+	}
+	loss := currency.Value(-100 * currency.Dollars)
+
+	type adj struct {
+		lot    *statement.Entry
+		shares int
+	}
+	early := washLot("GSU Class C", -30, 4)
+	late := washLot("ESPP", 30, 5)
+	tests := []struct {
+		name   string
+		soln   []solver.Entry
+		recent []*statement.Entry
+		want   []adj
+	}{
+		{"Loss", []solver.Entry{sell(lossLot, 8, loss)}, []*statement.Entry{early}, []adj{{early, 4}}},
+		{"Partial", []solver.Entry{sell(lossLot, 3, loss)}, []*statement.Entry{early}, []adj{{early, 3}}},
+
+		// Losses are matched to replacement shares in order of acquisition,
+		// in any plan.
+		{"Ordered", []solver.Entry{sell(lossLot, 6, loss)}, []*statement.Entry{late, early},
+			[]adj{{early, 4}, {late, 2}}},
+
+		{"Gain", []solver.Entry{sell(gainLot, 10, 800*currency.Dollars)}, []*statement.Entry{early}, nil},
+		{"NoLoss", []solver.Entry{sell(lossLot, 8, 0)}, []*statement.Entry{early}, nil},
+		{"OutsideWindow", []solver.Entry{sell(lossLot, 8, loss)},
+			[]*statement.Entry{washLot("GSU Class C", -31, 4), washLot("GSU Class C", 31, 4)}, nil},
+
+		// Replacement shares sold by the plan are not replacements.
+		{"SoldReplacement", []solver.Entry{sell(lossLot, 8, loss), sell(early, 3, 0)}, []*statement.Entry{early},
+			[]adj{{early, 1}}},
+		{"SoldLot", []solver.Entry{sell(lossLot, 4, loss)}, []*statement.Entry{lossLot}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := stockopt.WashSales(tc.soln, tc.recent, saleDate)
+			if len(got) != len(tc.want) {
+				t.Fatalf("WashSales: got %d adjustments, want %d: %+v", len(got), len(tc.want), got)
+			}
+			for i, a := range got {
+				if a.Lot != tc.want[i].lot || a.Shares != tc.want[i].shares || a.Disallowed != -loss {
+					t.Errorf("Adjustment %d: got %d shares of the lot acquired %v, disallowed %v; want %d of %v, %v",
+						i+1, a.Shares, a.Lot.Acquired.Format(statement.DateFormat), a.Disallowed,
+						tc.want[i].shares, tc.want[i].lot.Acquired.Format(statement.DateFormat), -loss)
+				}
+			}
+		})
+	}
+}